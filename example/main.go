@@ -11,6 +11,7 @@ func main() {
 		ConsoleJSONFormat:true,
 		ConsoleLevel: "debug",
 		EnableFile:true,
+		FileJSONFormat:true,
 		Name: "default.log",
 		Dir: "./logfiles",
 		Level: "info",
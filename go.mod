@@ -3,11 +3,14 @@ module github.com/mesment/sparrow
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/davecgh/go-spew v1.1.1
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/mitchellh/mapstructure v1.3.3
 	github.com/pkg/errors v0.9.1
 	github.com/sony/sonyflake v1.0.0
 	github.com/stretchr/testify v1.6.1
 	go.uber.org/zap v1.15.0
 	golang.org/x/tools v0.0.0-20191112195655-aa38f8e97acc // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -16,6 +16,7 @@ package conf
 
 import (
 	"io"
+	"os"
 
 	"github.com/davecgh/go-spew/spew"
 )
@@ -37,16 +38,46 @@ func OnChange(fn func(*Configuration)) {
 	defaultConfiguration.OnChange(fn)
 }
 
+// OnChangeEvent registers fn for every ChangeEvent with default defaultConfiguration.
+func OnChangeEvent(fn func(event *ChangeEvent)) (cancel func()) {
+	return defaultConfiguration.OnChangeEvent(fn)
+}
+
+// Watch registers fn for changes of keys under prefix with default defaultConfiguration.
+func Watch(prefix string, fn func(changes []Change)) (cancel func()) {
+	return defaultConfiguration.Watch(prefix, fn)
+}
+
 // LoadFromDataSource load configuration from data source
 // if data source supports dynamic config, a monitor goroutinue
 // would be
-func LoadFromDataSource(ds DataSource, unmarshaller Unmarshaller) error {
-	return defaultConfiguration.LoadFromDataSource(ds, unmarshaller)
+func LoadFromDataSource(ds DataSource, unmarshaller Unmarshaller, opts ...LoadOption) error {
+	return defaultConfiguration.LoadFromDataSource(ds, unmarshaller, opts...)
 }
 
 // Load loads configuration from provided provider with default defaultConfiguration.
-func LoadFromReader(r io.Reader, unmarshaller Unmarshaller) error {
-	return defaultConfiguration.LoadFromReader(r, unmarshaller)
+func LoadFromReader(r io.Reader, unmarshaller Unmarshaller, opts ...LoadOption) error {
+	return defaultConfiguration.LoadFromReader(r, unmarshaller, opts...)
+}
+
+// LoadFromFile loads configuration from file with default defaultConfiguration.
+func LoadFromFile(path string, opts ...LoadOption) error {
+	return defaultConfiguration.LoadFromFile(path, opts...)
+}
+
+// LoadFromEnv overlays environment variables with prefix with default defaultConfiguration.
+func LoadFromEnv(prefix string) {
+	defaultConfiguration.LoadFromEnv(prefix)
+}
+
+// BindFlags declares flags bound to configuration keys with default defaultConfiguration.
+func BindFlags(flags ...Flag) {
+	defaultConfiguration.BindFlags(flags...)
+}
+
+// ParseFlags parses os.Args and applies flags with default defaultConfiguration.
+func ParseFlags() error {
+	return defaultConfiguration.ParseFlags(os.Args[1:])
 }
 
 // Apply ...
@@ -55,13 +86,13 @@ func Apply(conf map[string]interface{}) error {
 }
 
 // Reset resets all to default settings.
-func Reset() {
-	defaultConfiguration = New()
+func Reset(opts ...Option) {
+	defaultConfiguration = New(opts...)
 }
 
 // Traverse ...
 func Traverse(sep string) map[string]interface{} {
-	return defaultConfiguration.traverse(sep)
+	return defaultConfiguration.Traverse(sep)
 }
 
 // Debug ...
@@ -74,7 +105,67 @@ func Get(key string) interface{} {
 	return defaultConfiguration.Get(key)
 }
 
+// SetDefault sets the default value for key with default defaultConfiguration.
+func SetDefault(key string, val interface{}) {
+	defaultConfiguration.SetDefault(key, val)
+}
+
+// Source returns the name of the layer providing key with default defaultConfiguration.
+func Source(key string) string {
+	return defaultConfiguration.Source(key)
+}
+
+// WriteConfig writes configuration to path with default defaultConfiguration.
+func WriteConfig(path string, opts ...WriteOption) error {
+	return defaultConfiguration.WriteConfig(path, opts...)
+}
+
+// GetE returns the value associated with the key with default defaultConfiguration.
+func GetE(key string) (interface{}, error) {
+	return defaultConfiguration.GetE(key)
+}
+
+// SetDecryptor registers the Decryptor of defaultConfiguration.
+func SetDecryptor(d Decryptor) {
+	defaultConfiguration.SetDecryptor(d)
+}
+
+// Snapshots returns the snapshots of defaultConfiguration.
+func Snapshots() []*Snapshot {
+	return defaultConfiguration.Snapshots()
+}
+
+// Rollback restores defaultConfiguration to snapshot version.
+func Rollback(version uint64) error {
+	return defaultConfiguration.Rollback(version)
+}
+
 // Set set config value for key
 func Set(key string, val interface{}) {
 	defaultConfiguration.Set(key, val)
 }
+
+// Bind binds key to ptr with default defaultConfiguration.
+func Bind(key string, ptr interface{}, opts ...BindOption) (*Binding, error) {
+	return defaultConfiguration.Bind(key, ptr, opts...)
+}
+
+// RegisterSchema registers the config struct of key with default defaultConfiguration.
+func RegisterSchema(key string, val interface{}, opts ...GetOption) {
+	defaultConfiguration.RegisterSchema(key, val, opts...)
+}
+
+// JSONSchema returns the JSON Schema of the structs registered to defaultConfiguration.
+func JSONSchema() ([]byte, error) {
+	return defaultConfiguration.JSONSchema()
+}
+
+// MarkdownDoc returns the Markdown reference of the structs registered to defaultConfiguration.
+func MarkdownDoc() []byte {
+	return defaultConfiguration.MarkdownDoc()
+}
+
+// YAMLDoc returns the sample YAML of the structs registered to defaultConfiguration.
+func YAMLDoc() []byte {
+	return defaultConfiguration.YAMLDoc()
+}
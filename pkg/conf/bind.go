@@ -0,0 +1,199 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Binding holds a typed value decoded from a key, the value is swapped
+// atomically whenever keys under the key change.
+type Binding struct {
+	c        *Configuration
+	key      string
+	template reflect.Value
+	value    atomic.Value
+
+	validate func(val interface{}) error
+	getOpts  []GetOption
+	cancel   func()
+
+	mu  sync.Mutex
+	err error
+}
+
+// BindOption ...
+type BindOption func(b *Binding)
+
+// BindValidator sets the validation hook, a reload rejected by the hook
+// keeps the last good value.
+func BindValidator(fn func(val interface{}) error) BindOption {
+	return func(b *Binding) {
+		b.validate = fn
+	}
+}
+
+// BindGetOptions sets the options used to decode the value.
+func BindGetOptions(opts ...GetOption) BindOption {
+	return func(b *Binding) {
+		b.getOpts = opts
+	}
+}
+
+// Bind decodes key into ptr and returns a Binding refreshed on every change under key.
+// The value ptr points to is used as the template of each reload, so fields
+// missing from the configuration keep the values set in it.
+func (c *Configuration) Bind(key string, ptr interface{}, opts ...BindOption) (*Binding, error) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.New("bind: ptr must be a non-nil pointer")
+	}
+
+	b := &Binding{
+		c:        c,
+		key:      key,
+		template: deepCopy(rv.Elem()),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	val, err := b.decode()
+	if err != nil {
+		return nil, err
+	}
+	rv.Elem().Set(deepCopy(reflect.ValueOf(val).Elem()))
+	b.value.Store(val)
+
+	b.cancel = c.Watch(key, func([]Change) {
+		b.reload()
+	})
+	return b, nil
+}
+
+// Load returns the current value, a pointer of the same type passed to Bind.
+// The returned value is shared and must not be modified.
+func (b *Binding) Load() interface{} {
+	return b.value.Load()
+}
+
+// Err returns the error of the last reload, nil if it succeeded.
+func (b *Binding) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// Close stops refreshing the value.
+func (b *Binding) Close() {
+	b.cancel()
+}
+
+func (b *Binding) reload() {
+	val, err := b.decode()
+	if err == nil {
+		b.value.Store(val)
+	}
+
+	b.mu.Lock()
+	b.err = err
+	b.mu.Unlock()
+}
+
+func (b *Binding) decode() (interface{}, error) {
+	// 每次从模板的深拷贝开始解码, 避免与模板及之前的值共享map、slice和指针
+	ptr := reflect.New(b.template.Type())
+	ptr.Elem().Set(deepCopy(b.template))
+
+	val := ptr.Interface()
+	if err := b.c.UnmarshalKey(b.key, val, b.getOpts...); err != nil {
+		return nil, err
+	}
+	if b.validate != nil {
+		if err := b.validate(val); err != nil {
+			return nil, errors.Wrapf(err, "validate %s", b.key)
+		}
+	}
+	return val, nil
+}
+
+// deepCopy returns a copy of v sharing no maps, slices or pointers with it,
+// unexported fields are copied shallowly.
+func deepCopy(v reflect.Value) reflect.Value {
+	return copyValue(v, make(map[visit]reflect.Value))
+}
+
+func copyValue(v reflect.Value, copied map[visit]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if c, ok := copied[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copied[key] = c
+		c.Elem().Set(copyValue(v.Elem(), copied))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, copyValue(v.MapIndex(k), copied))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copied))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copied))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i), copied))
+			}
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem(), copied))
+		return c
+	default:
+		return v
+	}
+}
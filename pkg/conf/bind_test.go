@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bindServer struct {
+	Host string
+	Port int
+}
+
+func TestConfiguration_Bind(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"server":{"port":8080},"other":1}`), JSONUnmarshaller))
+
+	server := bindServer{Host: "localhost"}
+	b, err := c.Bind("server", &server, BindValidator(func(val interface{}) error {
+		if val.(*bindServer).Port <= 0 {
+			return errors.New("invalid port")
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Equal(t, bindServer{Host: "localhost", Port: 8080}, server)
+	first := b.Load().(*bindServer)
+	assert.Equal(t, server, *first)
+
+	require.NoError(t, c.Set("server.port", 9090))
+	assert.Equal(t, bindServer{Host: "localhost", Port: 9090}, *b.Load().(*bindServer))
+	assert.NoError(t, b.Err())
+	// values loaded before are never modified
+	assert.Equal(t, 8080, first.Port)
+
+	// rejected reload keeps the last good value
+	require.NoError(t, c.Set("server.port", -1))
+	assert.Equal(t, 9090, b.Load().(*bindServer).Port)
+	assert.Error(t, b.Err())
+
+	require.NoError(t, c.Set("server.host", "example.com"))
+	require.NoError(t, c.Set("server.port", 80))
+	assert.Equal(t, bindServer{Host: "example.com", Port: 80}, *b.Load().(*bindServer))
+	assert.NoError(t, b.Err())
+
+	b.Close()
+	require.NoError(t, c.Set("server.port", 81))
+	assert.Equal(t, 80, b.Load().(*bindServer).Port)
+}
+
+type bindLabels struct {
+	Labels map[string]string
+	Hosts  []string
+	Next   *bindLabels
+}
+
+func TestConfiguration_BindTemplate(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"a":{"labels":{"x":"1"}}}`), JSONUnmarshaller))
+
+	tmpl := bindLabels{Labels: map[string]string{"z": "0"}, Hosts: []string{"h"}, Next: &bindLabels{Hosts: []string{"n"}}}
+	b, err := c.Bind("a", &tmpl)
+	require.NoError(t, err)
+	defer b.Close()
+	first := b.Load().(*bindLabels)
+	assert.Equal(t, map[string]string{"x": "1", "z": "0"}, first.Labels)
+
+	// readers iterate the loaded values while reloads decode new ones
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			for range b.Load().(*bindLabels).Labels {
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Set("a.labels.y", strconv.Itoa(i)))
+	}
+	<-done
+
+	// values loaded before and the template are never modified
+	assert.Equal(t, map[string]string{"x": "1", "z": "0"}, first.Labels)
+	assert.Equal(t, map[string]string{"x": "1", "z": "0"}, tmpl.Labels)
+	assert.Equal(t, map[string]string{"x": "1", "y": "9", "z": "0"}, b.Load().(*bindLabels).Labels)
+	tmpl.Hosts[0] = "changed"
+	tmpl.Next.Hosts[0] = "changed"
+	assert.Equal(t, []string{"h"}, b.Load().(*bindLabels).Hosts)
+	assert.Equal(t, []string{"n"}, first.Next.Hosts)
+}
+
+func TestConfiguration_BindError(t *testing.T) {
+	c := New()
+	_, err := c.Bind("server", bindServer{})
+	assert.Error(t, err)
+
+	var server bindServer
+	_, err = c.Bind("server", &server)
+	assert.Error(t, err)
+}
@@ -15,12 +15,17 @@
 package conf
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mesment/sparrow/pkg/util/xcast"
@@ -31,14 +36,41 @@ import (
 
 // Configuration provides configuration for application.
 type Configuration struct {
-	mu       sync.RWMutex
-	override map[string]interface{}
+	*store
+	// prefix 非空时为Sub返回的子视图, 所有key都相对于prefix
+	prefix string
+}
+
+// store holds the data shared by a Configuration and its Sub views.
+type store struct {
+	// state 当前配置的只读视图, 读操作无需加锁
+	state atomic.Value
+
+	// mu 串行化所有写操作, 保护以下字段
+	mu sync.Mutex
+	// layers 按优先级从低到高排列, 只在持有mu时修改, 发布到state的是其副本
+	layers   []*layer
+	layerSeq uint64
 	keyDelim string
+	// caseInsensitive 创建后不再修改
+	caseInsensitive bool
+	// decryptor 解密ENC(...)格式的加密配置
+	decryptor Decryptor
+
+	flagSet      *flag.FlagSet
+	flagBindings []*flagBinding
 
-	keyMap    *sync.Map
-	onChanges []func(*Configuration)
+	version     uint64
+	historySize int
 
-	watchers map[string][]func(*Configuration)
+	// schemas 通过RegisterSchema注册的配置结构体
+	schemas []*schemaEntry
+
+	// dispatchMu 保护watchers、pending和dispatching
+	dispatchMu  sync.Mutex
+	watchers    []*watcher
+	pending     [][]Change
+	dispatching bool
 }
 
 const (
@@ -46,58 +78,146 @@ const (
 )
 
 // New constructs a new Configuration with provider.
-func New() *Configuration {
-	return &Configuration{
-		override:  make(map[string]interface{}),
-		keyDelim:  defaultKeyDelim,
-		keyMap:    &sync.Map{},
-		onChanges: make([]func(*Configuration), 0),
-		watchers:  make(map[string][]func(*Configuration)),
+func New(opts ...Option) *Configuration {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	c := &Configuration{store: &store{
+		keyDelim:        defaultKeyDelim,
+		caseInsensitive: options.CaseInsensitive,
+		historySize:     defaultHistorySize,
+	}}
+	initial := &state{
+		tree:            make(map[string]interface{}),
+		keys:            make(map[string]interface{}),
+		flat:            make(map[string]interface{}),
+		keyDelim:        c.keyDelim,
+		caseInsensitive: c.caseInsensitive,
 	}
+	c.record(initial)
+	c.state.Store(initial)
+	return c
 }
 
 // SetKeyDelim set keyDelim of a defaultConfiguration instance.
 func (c *Configuration) SetKeyDelim(delim string) {
-	c.keyDelim = delim
+	c.update(func() {
+		c.keyDelim = delim
+	})
 }
 
-// Sub returns new Configuration instance representing a sub tree of this instance.
-func (c *Configuration) Sub(key string) *Configuration {
-	return &Configuration{
-		keyDelim: c.keyDelim,
-		override: c.GetStringMap(key),
+// ErrLayerNotFound is returned by WriteConfig when the layer to write does not exist,
+// e.g. WriteChangedOnly before any Set.
+var ErrLayerNotFound = errors.New("layer not found")
+
+// WriteConfig serializes the merged configuration, or a single layer with WriteLayer,
+// to path. The file is written to a temp file first and renamed over path.
+func (c *Configuration) WriteConfig(path string, opts ...WriteOption) error {
+	var options WriteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Format == "" {
+		options.Format = filepath.Ext(path)
+	}
+	marshaller, err := MarshallerFor(options.Format)
+	if err != nil {
+		return err
+	}
+
+	st := c.load()
+	data := st.tree
+	if options.Layer != "" {
+		data = nil
+		for _, l := range st.layers {
+			if l.name == options.Layer {
+				data = l.data
+				break
+			}
+		}
+		if data == nil {
+			// 不存在的层不能覆盖已有文件
+			return errors.Wrap(ErrLayerNotFound, options.Layer)
+		}
+	}
+	if c.prefix != "" {
+		sub, _ := searchPath(data, strings.Split(c.prefix, st.keyDelim))
+		if data, _ = sub.(map[string]interface{}); data == nil {
+			data = make(map[string]interface{})
+		}
+	}
+	content, err := marshaller(data)
+	if err != nil {
+		return err
 	}
+
+	return writeFileAtomic(path, content, 0644)
 }
 
-// WriteConfig ...
-func (c *Configuration) WriteConfig() error {
-	// return c.provider.Write(c.override)
-	return nil
+// writeFileAtomic writes content to a temp file in the same directory and renames it over path,
+// the mode of the existing file is preserved.
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
-// OnChange 注册change回调函数
+// OnChange 注册change回调函数, 任何修改配置的操作产生变更后都会回调
 func (c *Configuration) OnChange(fn func(*Configuration)) {
-	c.onChanges = append(c.onChanges, fn)
+	c.Watch("", func([]Change) {
+		fn(c)
+	})
 }
 
-// LoadFromDataSource ...
-func (c *Configuration) LoadFromDataSource(ds DataSource, unmarshaller Unmarshaller) error {
+// LoadFromDataSource loads configuration into the layer named by the data source
+// (see WithLayer), each reload replaces the content of the layer.
+func (c *Configuration) LoadFromDataSource(ds DataSource, unmarshaller Unmarshaller, opts ...LoadOption) error {
+	options := LoadOptions{Layer: dataSourceLayer(ds), Priority: PriorityFile}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	content, err := ds.ReadConfig()
 	if err != nil {
 		return err
 	}
 
-	if err := c.Load(content, unmarshaller); err != nil {
+	if err := c.replace(content, unmarshaller, options); err != nil {
 		return err
 	}
 
 	go func() {
 		for range ds.IsConfigChanged() {
 			if content, err := ds.ReadConfig(); err == nil {
-				_ = c.Load(content, unmarshaller)
-				for _, change := range c.onChanges {
-					change(c)
-				}
+				_ = c.replace(content, unmarshaller, options)
 			}
 		}
 	}()
@@ -105,98 +225,162 @@ func (c *Configuration) LoadFromDataSource(ds DataSource, unmarshaller Unmarshal
 	return nil
 }
 
-// Load ...
-func (c *Configuration) Load(content []byte, unmarshal Unmarshaller) error {
+// Load loads content into the content layer, or the layer specified by WithLayer,
+// content is merged with the data already in the layer.
+func (c *Configuration) Load(content []byte, unmarshal Unmarshaller, opts ...LoadOption) error {
+	options := LoadOptions{Layer: LayerContent, Priority: PriorityFile}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	configuration := make(map[string]interface{})
 	if err := unmarshal(content, &configuration); err != nil {
 		return err
 	}
-	return c.apply(configuration)
+	return c.applyLayer(options.Layer, options.Priority, options.StringValues, configuration)
+}
+
+// replace unmarshal content and replaces the layer with it.
+func (c *Configuration) replace(content []byte, unmarshal Unmarshaller, options LoadOptions) error {
+	configuration := make(map[string]interface{})
+	if err := unmarshal(content, &configuration); err != nil {
+		return err
+	}
+	configuration = c.insensitivise(c.nest(normalize(configuration).(map[string]interface{})))
+	c.update(func() {
+		l := c.setLayer(options.Layer, options.Priority, configuration)
+		l.strings = options.StringValues
+	})
+	return nil
 }
 
 // Load loads configuration from provided data source.
-func (c *Configuration) LoadFromReader(reader io.Reader, unmarshaller Unmarshaller) error {
+func (c *Configuration) LoadFromReader(reader io.Reader, unmarshaller Unmarshaller, opts ...LoadOption) error {
 	content, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return err
 	}
-	return c.Load(content, unmarshaller)
+	return c.Load(content, unmarshaller, opts...)
 }
 
-func (c *Configuration) apply(conf map[string]interface{}) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	var changes = make(map[string]interface{})
-
-	xmap.MergeStringMap(c.override, conf)
-	for k, v := range c.traverse(c.keyDelim) {
-		orig, ok := c.keyMap.Load(k)
-		if ok && !reflect.DeepEqual(orig, v) {
-			changes[k] = v
-		}
-		c.keyMap.Store(k, v)
+// LoadFromFile loads configuration from file into layer "file:<path>", the unmarshaller
+// is picked from the file extension or by sniffing the content.
+func (c *Configuration) LoadFromFile(path string, opts ...LoadOption) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	unmarshaller, err := DetectUnmarshaller(path, content)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
 	}
+	return c.Load(content, unmarshaller, append([]LoadOption{WithLayer(fileLayer(path), PriorityFile)}, opts...)...)
+}
+
+// LoadFromEnv overlays environment variables with prefix as layer "env",
+// the overlay takes precedence over file content and survives later loads and reloads.
+// e.g. with prefix "SPARROW_", SPARROW_FOO_BAR_BAZ overrides "foo.bar.baz",
+// a double underscore is kept as a literal underscore: SPARROW_MAX__SIZE overrides "max_size".
+// Env keys override the keys of other layers case insensitively: SPARROW_LOGGER_MAXSIZE overrides "logger.maxSize".
+func (c *Configuration) LoadFromEnv(prefix string) {
+	c.update(func() {
+		env := c.setLayer(LayerEnv, PriorityEnv, make(map[string]interface{}))
+		env.strings = true
+		env.fold = true
+		for _, kv := range os.Environ() {
+			idx := strings.Index(kv, "=")
+			if idx < 0 || !strings.HasPrefix(kv[:idx], prefix) || len(kv[:idx]) == len(prefix) {
+				continue
+			}
+			c.setPath(env, c.envKey(kv[len(prefix):idx]), kv[idx+1:])
+		}
+	})
+}
 
-	if len(changes) > 0 {
-		c.notifyChanges(changes)
+// envKey maps FOO_BAR__BAZ to foo.bar_baz
+func (c *Configuration) envKey(name string) string {
+	parts := strings.Split(strings.ToLower(name), "__")
+	for i, part := range parts {
+		parts[i] = strings.Replace(part, "_", c.keyDelim, -1)
 	}
+	return strings.Join(parts, "_")
+}
 
-	return nil
+func (c *Configuration) apply(conf map[string]interface{}) error {
+	return c.applyLayer(LayerContent, PriorityFile, false, conf)
 }
 
-func (c *Configuration) notifyChanges(changes map[string]interface{}) {
-	var changedWatchPrefixMap = map[string]struct{}{}
+// applyLayer merges conf into layer name, stringValues marks the layer as holding strings only.
+func (c *Configuration) applyLayer(name string, priority int, stringValues bool, conf map[string]interface{}) error {
+	c.update(func() {
+		l := c.lazyLayer(name, priority)
+		l.strings = l.strings || stringValues
+		overlay(l.data, c.insensitivise(c.nest(normalize(xmap.CloneStringMap(conf)).(map[string]interface{}))), false)
+	})
+	return nil
+}
 
-	for watchPrefix := range c.watchers {
-		for key := range changes {
-			// 前缀匹配即可
-			// todo 可能产生错误匹配
-			if strings.HasPrefix(key, watchPrefix) {
-				changedWatchPrefixMap[watchPrefix] = struct{}{}
-			}
-		}
-	}
+// update runs fn with mu held, then publishes the new state and delivers the changes.
+func (c *Configuration) update(fn func()) {
+	c.mu.Lock()
+	fn()
+	c.rebuild()
+	c.mu.Unlock()
 
-	for changedWatchPrefix := range changedWatchPrefixMap {
-		for _, handle := range c.watchers[changedWatchPrefix] {
-			go handle(c)
-		}
-	}
+	c.dispatch()
 }
 
-// Set ...
+// ErrIndexOutOfRange is returned by Set when the key addresses a slice element
+// beyond the end, only existing elements can be set or one appended.
+var ErrIndexOutOfRange = errors.New("index out of range")
+
+// Set sets value for key in layer "runtime", which has the highest priority.
 func (c *Configuration) Set(key string, val interface{}) error {
-	paths := strings.Split(key, c.keyDelim)
-	lastKey := paths[len(paths)-1]
-	m := deepSearch(c.override, paths[:len(paths)-1])
-	m[lastKey] = val
-	return c.apply(m)
-	// c.keyMap.Store(key, val)
+	key = c.key(key)
+	var err error
+	c.update(func() {
+		if err = c.load().checkIndex(key); err != nil {
+			return
+		}
+		c.setPath(c.lazyLayer(LayerRuntime, PriorityRuntime), key, val)
+	})
+	return err
 }
 
-func deepSearch(m map[string]interface{}, path []string) map[string]interface{} {
-	for _, k := range path {
-		m2, ok := m[k]
-		if !ok {
-			m3 := make(map[string]interface{})
-			m[k] = m3
-			m = m3
-			continue
-		}
-		m3, ok := m2.(map[string]interface{})
-		if !ok {
-			m3 = make(map[string]interface{})
-			m[k] = m3
+// deepSet sets val at path under node and returns the updated node, existing slice
+// elements are addressed by index, missing nodes are created as maps.
+func deepSet(node interface{}, path []string, val interface{}) interface{} {
+	if len(path) == 0 {
+		return val
+	}
+	if s, ok := node.([]interface{}); ok {
+		if idx, err := strconv.Atoi(path[0]); err == nil && idx >= 0 && idx < len(s) {
+			s[idx] = deepSet(s[idx], path[1:], val)
+			return s
 		}
-		m = m3
 	}
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{})
+	}
+	m[path[0]] = deepSet(m[path[0]], path[1:], val)
 	return m
 }
 
-// Get returns the value associated with the key
+// Get returns the value associated with the key, placeholders like ${env:HOME},
+// ${file:/run/secrets/db} and ${other.key} are expanded, see GetE.
+// Maps and slices returned are shared and must not be modified.
 func (c *Configuration) Get(key string) interface{} {
-	return c.find(key)
+	key = c.key(key)
+	st := c.load()
+	val := st.find(key)
+	if resolved, err := st.resolveValue(key, val); err == nil {
+		return resolved
+	}
+	return val
 }
 
 // GetString returns the value associated with the key as a string with default defaultConfiguration.
@@ -354,41 +538,120 @@ func (c *Configuration) UnmarshalKey(key string, rawVal interface{}, opts ...Get
 	}
 
 	config := mapstructure.DecoderConfig{
-		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
-		Result:     rawVal,
-		TagName:    options.TagName,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			stringValueHookFunc(),
+			mapstructure.StringToTimeDurationHookFunc(),
+		),
+		Result:  rawVal,
+		TagName: options.TagName,
 	}
 	decoder, err := mapstructure.NewDecoder(&config)
 	if err != nil {
 		return err
 	}
-	if key == "" {
-		c.mu.RLock()
-		defer c.mu.RUnlock()
-		return decoder.Decode(c.override)
-	}
 
-	value := c.Get(key)
+	key = c.key(key)
+	st := c.load()
+	var value interface{} = st.tree
+	if key != "" {
+		value = st.find(key)
+	}
+	if value == nil && options.DefaultTagName != "" {
+		// 整段配置缺失时使用默认值
+		data := make(map[string]interface{})
+		applyDefaults(reflect.TypeOf(rawVal), data, options, nil)
+		if len(data) > 0 {
+			value = data
+		}
+	}
 	if value == nil {
 		return errors.Wrap(ErrInvalidKey, key)
 	}
+	if value, err = st.resolveValue(key, value); err != nil {
+		return err
+	}
+
+	if options.DefaultTagName != "" {
+		if data, err := xcast.ToStringMapE(value); err == nil {
+			data = xmap.CloneStringMap(data)
+			applyDefaults(reflect.TypeOf(rawVal), data, options, nil)
+			value = data
+		}
+	}
+	value = st.markStrings(key, value)
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
 
-	return decoder.Decode(value)
+	if options.ValidateTagName != "" {
+		var errs ValidationErrors
+		validateStruct(reflect.ValueOf(rawVal), key, options, &errs, make(map[visit]bool))
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+	return nil
 }
 
-func (c *Configuration) find(key string) interface{} {
-	dd, ok := c.keyMap.Load(key)
-	if ok {
-		return dd
+// stringValue is a string decoded weakly, e.g. "8080" into int, by UnmarshalKey.
+type stringValue string
+
+// markStrings returns a copy of val at key, strings provided by string only layers,
+// expanded from placeholders or filled by default tags are marked as stringValue.
+func (st *state) markStrings(key string, val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = st.markStrings(st.childKey(key, k), item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = st.markStrings(st.childKey(key, strconv.Itoa(i)), item)
+		}
+		return s
+	case string:
+		if raw, ok := st.lookupRaw(key); !ok || raw != val {
+			return stringValue(v)
+		}
+		if l := st.sourceLayer(key); l != nil && l.strings {
+			return stringValue(v)
+		}
 	}
+	return val
+}
 
-	paths := strings.Split(key, c.keyDelim)
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	m := xmap.DeepSearchInMap(c.override, paths[:len(paths)-1]...)
-	dd = m[paths[len(paths)-1]]
-	c.keyMap.Store(key, dd)
-	return dd
+func (st *state) childKey(key, sub string) string {
+	if key == "" {
+		return sub
+	}
+	return key + st.keyDelim + sub
+}
+
+// stringValueHookFunc decodes stringValue weakly into scalar types, other values are decoded strictly.
+func stringValueHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		s, ok := data.(stringValue)
+		if !ok {
+			return data, nil
+		}
+		switch t.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if t == durationType {
+				break
+			}
+			out := reflect.New(t)
+			if err := mapstructure.WeakDecode(string(s), out.Interface()); err != nil {
+				return nil, err
+			}
+			return out.Elem().Interface(), nil
+		}
+		return string(s), nil
+	}
 }
 
 func lookup(prefix string, target map[string]interface{}, data map[string]interface{}, sep string) {
@@ -397,16 +660,22 @@ func lookup(prefix string, target map[string]interface{}, data map[string]interf
 		if prefix == "" {
 			pp = k
 		}
-		if dd, err := xcast.ToStringMapE(v); err == nil {
-			lookup(pp, dd, data, sep)
-		} else {
-			data[pp] = v
-		}
+		flatten(pp, v, data, sep)
 	}
 }
 
-func (c *Configuration) traverse(sep string) map[string]interface{} {
-	data := make(map[string]interface{})
-	lookup("", c.override, data, sep)
-	return data
+// flatten stores v at key in data, maps and non-empty slices are flattened
+// with keys and indices, e.g. servers.0.host.
+func flatten(key string, v interface{}, data map[string]interface{}, sep string) {
+	if dd, err := xcast.ToStringMapE(v); err == nil {
+		lookup(key, dd, data, sep)
+		return
+	}
+	if s, ok := v.([]interface{}); ok && len(s) > 0 {
+		for i, item := range s {
+			flatten(key+sep+strconv.Itoa(i), item, data, sep)
+		}
+		return
+	}
+	data[key] = v
 }
@@ -0,0 +1,216 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setenv(t *testing.T, key, value string) {
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestConfiguration_LoadFromEnv(t *testing.T) {
+	setenv(t, "SPARROW_TEST_APP_MODE", "prod")
+	setenv(t, "SPARROW_TEST_APP_PORT", "9090")
+	setenv(t, "SPARROW_TEST_APP_MAX__SIZE", "10")
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"app":{"mode":"dev","port":8080,"name":"demo"}}`), JSONUnmarshaller))
+	c.LoadFromEnv("SPARROW_TEST_")
+
+	assert.Equal(t, "prod", c.GetString("app.mode"))
+	assert.Equal(t, 9090, c.GetInt("app.port"))
+	assert.Equal(t, 10, c.GetInt("app.max_size"))
+	assert.Equal(t, "demo", c.GetString("app.name"))
+	assert.Equal(t, "prod", c.load().traverse(".")["app.mode"])
+
+	var app struct {
+		Mode string
+		Port int
+		Name string
+	}
+	require.NoError(t, c.UnmarshalKey("app", &app))
+	assert.Equal(t, "prod", app.Mode)
+	assert.Equal(t, 9090, app.Port)
+	assert.Equal(t, "demo", app.Name)
+
+	// env overlay takes precedence over reloaded content
+	require.NoError(t, c.Load([]byte(`{"app":{"mode":"test","name":"demo2"}}`), JSONUnmarshaller))
+	assert.Equal(t, "prod", c.GetString("app.mode"))
+	assert.Equal(t, "demo2", c.GetString("app.name"))
+}
+
+func TestConfiguration_LoadFromEnvCamelCase(t *testing.T) {
+	setenv(t, "SPARROW_TEST_LOGGER_MAXSIZE", "20")
+
+	c := New()
+	c.LoadFromEnv("SPARROW_TEST_")
+	// the env overlay matches keys loaded later as well
+	require.NoError(t, c.Load([]byte(`{"logger":{"maxSize":10,"name":"app"}}`), JSONUnmarshaller))
+
+	assert.Equal(t, "20", c.Get("logger.maxSize"))
+	assert.Equal(t, LayerEnv, c.Source("logger.maxSize"))
+	assert.NotContains(t, c.Traverse("."), "logger.maxsize")
+	for i := 0; i < 20; i++ {
+		var logger struct {
+			MaxSize int
+			Name    string
+		}
+		require.NoError(t, c.UnmarshalKey("logger", &logger))
+		assert.Equal(t, 20, logger.MaxSize)
+	}
+}
+
+func TestConfiguration_UnmarshalKeyStringValues(t *testing.T) {
+	setenv(t, "SPARROW_TEST_APP_DEBUG", "1")
+	setenv(t, "SPARROW_TEST_PORT", "9090")
+
+	type app struct {
+		Port    int
+		Debug   bool
+		Retries int
+		Timeout time.Duration
+	}
+
+	// values of typed layers are decoded strictly
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"app":{"port":""}}`), JSONUnmarshaller))
+	assert.Error(t, c.UnmarshalKey("app", &app{}))
+	require.NoError(t, c.Load([]byte(`{"app":{"port":8080,"debug":"1"}}`), JSONUnmarshaller))
+	assert.Error(t, c.UnmarshalKey("app", &app{}))
+
+	// strings from env, string only layers and placeholders are converted
+	require.NoError(t, c.Load([]byte(`{"app":{"port":"${env:SPARROW_TEST_PORT}","timeout":"3s"}}`), JSONUnmarshaller))
+	c.LoadFromEnv("SPARROW_TEST_")
+	require.NoError(t, c.Load([]byte(`{"app":{"retries":"3"}}`), JSONUnmarshaller, WithLayer("kv", PriorityRemote), WithStringValues()))
+	var a app
+	require.NoError(t, c.UnmarshalKey("app", &a))
+	assert.Equal(t, app{Port: 9090, Debug: true, Retries: 3, Timeout: 3 * time.Second}, a)
+}
+
+func TestConfiguration_LoadFromEnvKeyDelim(t *testing.T) {
+	setenv(t, "SPARROW_TEST_APP_MODE", "prod")
+
+	c := New()
+	c.SetKeyDelim("/")
+	c.LoadFromEnv("SPARROW_TEST_")
+	assert.Equal(t, "prod", c.GetString("app/mode"))
+}
+
+func TestConfiguration_Set(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"app":{"mode":"dev"}}`), JSONUnmarshaller))
+	require.NoError(t, c.Set("app.log.level", "debug"))
+
+	assert.Equal(t, "dev", c.GetString("app.mode"))
+	assert.Equal(t, "debug", c.GetString("app.log.level"))
+	assert.Nil(t, c.Get("log"))
+}
+
+func TestConfiguration_WriteConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"app":{"mode":"dev","port":8080}}`), JSONUnmarshaller))
+	require.NoError(t, c.Set("app.mode", "prod"))
+
+	for _, name := range []string{"app.json", "app.yaml", "app.toml"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, c.WriteConfig(path), name)
+
+		loaded := New()
+		require.NoError(t, loaded.LoadFromFile(path), name)
+		assert.Equal(t, "prod", loaded.GetString("app.mode"), name)
+		assert.Equal(t, 8080, loaded.GetInt("app.port"), name)
+	}
+
+	path := filepath.Join(dir, "changed.conf")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	require.NoError(t, c.WriteConfig(path, WriteChangedOnly(), WriteFormat(FormatYAML)))
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "app:\n  mode: prod\n", string(content))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// no temp files left behind
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+
+	assert.Error(t, c.WriteConfig(filepath.Join(dir, "app.ini")))
+
+	// missing layers never overwrite the file
+	err = c.WriteConfig(path, WriteLayer("file:/typo.yaml"), WriteFormat(FormatYAML))
+	assert.True(t, errors.Is(err, ErrLayerNotFound), "%v", err)
+	err = New().WriteConfig(path, WriteChangedOnly(), WriteFormat(FormatYAML))
+	assert.True(t, errors.Is(err, ErrLayerNotFound), "%v", err)
+	content, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "app:\n  mode: prod\n", string(content))
+}
+
+func TestConfiguration_CaseInsensitive(t *testing.T) {
+	setenv(t, "SPARROW_TEST_LOGGER_DIR", "/var/log")
+
+	c := New(CaseInsensitive())
+	require.NoError(t, c.Load([]byte(`{"Logger":{"Level":"info","MaxSize":10},"App":{"Name":"${logger.LEVEL}"}}`), JSONUnmarshaller))
+	c.LoadFromEnv("SPARROW_TEST_")
+
+	assert.Equal(t, "info", c.GetString("logger.level"))
+	assert.Equal(t, "info", c.GetString("LOGGER.Level"))
+	assert.Equal(t, "info", c.GetString("app.name"))
+	assert.Equal(t, "/var/log", c.GetString("Logger.Dir"))
+	assert.Equal(t, "info", c.Sub("LOGGER").GetString("level"))
+
+	var changes []Change
+	cancel := c.Watch("LOGGER", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancel()
+	require.NoError(t, c.Set("Logger.Level", "debug"))
+	assert.Equal(t, "debug", c.GetString("logger.level"))
+	assert.Equal(t, []Change{{Type: ChangeModified, Key: "logger.level", Old: "info", New: "debug"}}, changes)
+	assert.Equal(t, LayerRuntime, c.Source("LOGGER.LEVEL"))
+
+	var logger struct {
+		Level   string
+		MaxSize int `mapstructure:"maxSize"`
+		Dir     string
+	}
+	require.NoError(t, c.UnmarshalKey("Logger", &logger))
+	assert.Equal(t, "debug", logger.Level)
+	assert.Equal(t, 10, logger.MaxSize)
+	assert.Equal(t, "/var/log", logger.Dir)
+
+	// keys stay case sensitive by default
+	c = New()
+	require.NoError(t, c.Load([]byte(`{"Logger":{"Level":"info"}}`), JSONUnmarshaller))
+	assert.Equal(t, "", c.GetString("logger.level"))
+	assert.Equal(t, "info", c.GetString("Logger.Level"))
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	encPrefix = "ENC("
+	encSuffix = ")"
+	// redacted replaces secret values in Traverse and Debug
+	redacted = "******"
+)
+
+// ErrNoDecryptor is returned when reading an encrypted value without a Decryptor.
+var ErrNoDecryptor = errors.New("no decryptor registered")
+
+// Decryptor decrypts the values marked as ENC(base64 ciphertext).
+type Decryptor interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// DecryptorFunc ...
+type DecryptorFunc func(ciphertext []byte) ([]byte, error)
+
+// Decrypt ...
+func (fn DecryptorFunc) Decrypt(ciphertext []byte) ([]byte, error) {
+	return fn(ciphertext)
+}
+
+// SetDecryptor registers the Decryptor used to decrypt ENC(...) values.
+func (c *Configuration) SetDecryptor(d Decryptor) {
+	c.update(func() {
+		c.decryptor = d
+	})
+}
+
+func isEncrypted(s string) bool {
+	return strings.HasPrefix(s, encPrefix) && strings.HasSuffix(s, encSuffix)
+}
+
+func decrypt(d Decryptor, s string) (string, error) {
+	if d == nil {
+		return "", ErrNoDecryptor
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(s[len(encPrefix) : len(s)-len(encSuffix)])
+	if err != nil {
+		return "", errors.Wrap(err, "decode encrypted value")
+	}
+	plaintext, err := d.Decrypt(ciphertext)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypt encrypted value")
+	}
+	return string(plaintext), nil
+}
+
+// AESGCM is a Decryptor using AES-GCM, the ciphertext is nonce followed by the sealed data.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM constructs an AESGCM with a 16, 24 or 32 bytes key.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// NewAESGCMFromFile constructs an AESGCM with the base64 encoded key in file,
+// such a key file can be generated by `openssl rand -base64 32`.
+func NewAESGCMFromFile(path string) (*AESGCM, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode key file %s", path)
+	}
+	return NewAESGCM(key)
+}
+
+// Decrypt ...
+func (a *AESGCM) Decrypt(ciphertext []byte) ([]byte, error) {
+	size := a.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("ciphertext too short")
+	}
+	return a.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
+
+// Encrypt returns plaintext encrypted in the ENC(...) format.
+func (a *AESGCM) Encrypt(plaintext []byte) (string, error) {
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := a.aead.Seal(nonce, nonce, plaintext, nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed) + encSuffix, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAESGCMFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf-crypto")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	path := filepath.Join(dir, "app.key")
+	require.NoError(t, ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+
+	a, err := NewAESGCM(key)
+	require.NoError(t, err)
+	b, err := NewAESGCMFromFile(path)
+	require.NoError(t, err)
+
+	value, err := a.Encrypt([]byte("s3cret"))
+	require.NoError(t, err)
+	plaintext, err := decrypt(b, value)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plaintext)
+
+	_, err = NewAESGCMFromFile(filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte("not base64"), 0600))
+	_, err = NewAESGCMFromFile(path)
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+	_, err = NewAESGCMFromFile(path)
+	assert.Error(t, err)
+}
+
+func TestConfiguration_Decryptor(t *testing.T) {
+	aes, err := NewAESGCM([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	password, err := aes.Encrypt([]byte("s3cret"))
+	require.NoError(t, err)
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"user":"root","password":"`+password+`","dsn":"${db.user}:${db.password}@tcp(127.0.0.1)"}}`), JSONUnmarshaller))
+
+	// no decryptor registered
+	_, err = c.GetE("db.password")
+	assert.True(t, errors.Is(err, ErrNoDecryptor))
+	assert.Equal(t, password, c.GetString("db.password"))
+	assert.Equal(t, redacted, c.Traverse(".")["db.password"])
+
+	c.SetDecryptor(aes)
+	assert.Equal(t, "s3cret", c.GetString("db.password"))
+	assert.Equal(t, "root:s3cret@tcp(127.0.0.1)", c.GetString("db.dsn"))
+
+	var db struct {
+		User     string
+		Password string
+	}
+	require.NoError(t, c.UnmarshalKey("db", &db))
+	assert.Equal(t, "s3cret", db.Password)
+
+	flat := c.Traverse(".")
+	assert.Equal(t, "root", flat["db.user"])
+	assert.Equal(t, redacted, flat["db.password"])
+	assert.Equal(t, redacted, flat["db.dsn"])
+
+	// tampered ciphertext
+	require.NoError(t, c.Set("db.password", "ENC(AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA)"))
+	_, err = c.GetE("db.password")
+	assert.Error(t, err)
+}
+
+func TestConfiguration_DecryptorChanges(t *testing.T) {
+	aes, err := NewAESGCM([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	password, err := aes.Encrypt([]byte("hunter2"))
+	require.NoError(t, err)
+
+	c := New()
+	c.SetDecryptor(aes)
+	require.NoError(t, c.Load([]byte(`{"db":{"user":"root","dsn":"${db.user}:${db.password}@tcp(127.0.0.1)"}}`), JSONUnmarshaller))
+
+	var changes []Change
+	c.OnChangeEvent(func(event *ChangeEvent) {
+		changes = append(changes, event.Changes...)
+	})
+	c.Watch("db", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+
+	require.NoError(t, c.Set("db.password", password))
+	assert.Equal(t, "hunter2", c.GetString("db.password"))
+
+	// 变更中不会出现明文, 引用加密值的db.dsn也不会解析
+	require.Len(t, changes, 2)
+	for _, change := range changes {
+		assert.NotContains(t, fmt.Sprint(change.Old, change.New), "hunter2", change.Key)
+	}
+	assert.Equal(t, Change{Type: ChangeAdded, Key: "db.password", New: password}, changes[0])
+
+	// 密文变化时仍能收到变更
+	changes = nil
+	rotated, err := aes.Encrypt([]byte("hunter3"))
+	require.NoError(t, err)
+	require.NoError(t, c.Set("db.password", rotated))
+	require.Len(t, changes, 2)
+	assert.Equal(t, Change{Type: ChangeModified, Key: "db.password", Old: password, New: rotated}, changes[0])
+}
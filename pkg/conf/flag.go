@@ -0,0 +1,194 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Flag 命令行参数, 解析后绑定到配置key
+type Flag interface {
+	bind(fs *flag.FlagSet) *flagBinding
+}
+
+type flagBinding struct {
+	name  string
+	key   string
+	value func() interface{}
+}
+
+func newFlagBinding(name, key string, value func() interface{}) *flagBinding {
+	if key == "" {
+		key = name
+	}
+	return &flagBinding{name: name, key: key, value: value}
+}
+
+// StringFlag ...
+type StringFlag struct {
+	Name string
+	// Key 绑定的配置key, 为空时与Name相同
+	Key     string
+	Usage   string
+	Default string
+}
+
+func (f StringFlag) bind(fs *flag.FlagSet) *flagBinding {
+	p := fs.String(f.Name, f.Default, f.Usage)
+	return newFlagBinding(f.Name, f.Key, func() interface{} { return *p })
+}
+
+// IntFlag ...
+type IntFlag struct {
+	Name    string
+	Key     string
+	Usage   string
+	Default int
+}
+
+func (f IntFlag) bind(fs *flag.FlagSet) *flagBinding {
+	p := fs.Int(f.Name, f.Default, f.Usage)
+	return newFlagBinding(f.Name, f.Key, func() interface{} { return *p })
+}
+
+// BoolFlag ...
+type BoolFlag struct {
+	Name    string
+	Key     string
+	Usage   string
+	Default bool
+}
+
+func (f BoolFlag) bind(fs *flag.FlagSet) *flagBinding {
+	p := fs.Bool(f.Name, f.Default, f.Usage)
+	return newFlagBinding(f.Name, f.Key, func() interface{} { return *p })
+}
+
+// DurationFlag ...
+type DurationFlag struct {
+	Name    string
+	Key     string
+	Usage   string
+	Default time.Duration
+}
+
+func (f DurationFlag) bind(fs *flag.FlagSet) *flagBinding {
+	p := fs.Duration(f.Name, f.Default, f.Usage)
+	return newFlagBinding(f.Name, f.Key, func() interface{} { return *p })
+}
+
+// StringSliceFlag accepts comma separated values and can be repeated,
+// e.g. --app.hosts=a,b --app.hosts=c
+type StringSliceFlag struct {
+	Name    string
+	Key     string
+	Usage   string
+	Default []string
+}
+
+func (f StringSliceFlag) bind(fs *flag.FlagSet) *flagBinding {
+	v := &stringSliceValue{values: append([]string(nil), f.Default...)}
+	fs.Var(v, f.Name, f.Usage)
+	return newFlagBinding(f.Name, f.Key, func() interface{} {
+		return append([]string(nil), v.values...)
+	})
+}
+
+type stringSliceValue struct {
+	values []string
+	set    bool
+}
+
+// Set ...
+func (v *stringSliceValue) Set(s string) error {
+	// 第一次设置时覆盖默认值
+	if !v.set {
+		v.values = v.values[:0]
+		v.set = true
+	}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			v.values = append(v.values, item)
+		}
+	}
+	return nil
+}
+
+// String ...
+func (v *stringSliceValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(v.values, ",")
+}
+
+// FlagSet returns the flag set used by ParseFlags, it can be used to customize usage.
+func (c *Configuration) FlagSet() *flag.FlagSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lazyFlagSet()
+}
+
+func (c *Configuration) lazyFlagSet() *flag.FlagSet {
+	if c.flagSet == nil {
+		c.flagSet = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	}
+	return c.flagSet
+}
+
+// BindFlags declares flags bound to configuration keys.
+func (c *Configuration) BindFlags(flags ...Flag) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fs := c.lazyFlagSet()
+	for _, f := range flags {
+		c.flagBindings = append(c.flagBindings, f.bind(fs))
+	}
+}
+
+// ParseFlags parses args(without the program name), flags set explicitly
+// are applied as layer "flag" over file content and env, non-zero defaults
+// of the other flags are applied as layer "default".
+func (c *Configuration) ParseFlags(args []string) error {
+	fs := c.FlagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	visited := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+
+	c.update(func() {
+		flags := c.setLayer(LayerFlag, PriorityFlag, make(map[string]interface{}))
+		for _, binding := range c.flagBindings {
+			if visited[binding.name] {
+				c.setPath(flags, binding.key, binding.value())
+				continue
+			}
+			// 未指定的参数使用默认值, 优先级低于配置文件和环境变量
+			if val := binding.value(); !reflect.ValueOf(val).IsZero() {
+				c.setPath(c.lazyLayer(LayerDefault, PriorityDefault), binding.key, val)
+			}
+		}
+	})
+	return nil
+}
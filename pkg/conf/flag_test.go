@@ -0,0 +1,97 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_ParseFlags(t *testing.T) {
+	setenv(t, "SPARROW_TEST_LOGGER_LEVEL", "info")
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"logger":{"level":"warn","name":"app.log"},"app":{"port":80}}`), JSONUnmarshaller))
+	c.LoadFromEnv("SPARROW_TEST_")
+	c.BindFlags(
+		StringFlag{Name: "logger.level", Usage: "log level"},
+		StringFlag{Name: "name", Key: "logger.name", Default: "default.log"},
+		IntFlag{Name: "port", Key: "app.port"},
+		BoolFlag{Name: "debug", Key: "app.debug"},
+		DurationFlag{Name: "timeout", Key: "app.timeout"},
+		StringSliceFlag{Name: "hosts", Key: "app.hosts", Default: []string{"localhost"}},
+	)
+	require.NoError(t, c.ParseFlags([]string{
+		"--logger.level=debug",
+		"-port", "8080",
+		"--debug",
+		"--timeout=3s",
+		"--hosts=a,b", "--hosts", "c",
+	}))
+
+	assert.Equal(t, "debug", c.GetString("logger.level"))
+	// flag not set explicitly leaves the loaded value untouched
+	assert.Equal(t, "app.log", c.GetString("logger.name"))
+	assert.Equal(t, 8080, c.GetInt("app.port"))
+	assert.True(t, c.GetBool("app.debug"))
+	assert.Equal(t, 3*time.Second, c.GetDuration("app.timeout"))
+	assert.Equal(t, []string{"a", "b", "c"}, c.GetStringSlice("app.hosts"))
+
+	// flags survive reloads
+	require.NoError(t, c.Load([]byte(`{"logger":{"level":"error"}}`), JSONUnmarshaller))
+	assert.Equal(t, "debug", c.GetString("logger.level"))
+
+	var app struct {
+		Port    int
+		Timeout time.Duration
+		Hosts   []string
+	}
+	require.NoError(t, c.UnmarshalKey("app", &app))
+	assert.Equal(t, 8080, app.Port)
+	assert.Equal(t, 3*time.Second, app.Timeout)
+	assert.Equal(t, []string{"a", "b", "c"}, app.Hosts)
+}
+
+func TestConfiguration_ParseFlagsDefault(t *testing.T) {
+	c := New()
+	c.BindFlags(
+		StringFlag{Name: "name", Key: "logger.name", Default: "default.log"},
+		IntFlag{Name: "port", Key: "app.port", Default: 8080},
+		BoolFlag{Name: "debug", Key: "app.debug"},
+	)
+	require.NoError(t, c.ParseFlags(nil))
+
+	// defaults of flags not passed are applied with the lowest priority
+	assert.Equal(t, "default.log", c.GetString("logger.name"))
+	assert.Equal(t, 8080, c.GetInt("app.port"))
+	assert.Equal(t, LayerDefault, c.Source("app.port"))
+	assert.Nil(t, c.Get("app.debug"))
+
+	require.NoError(t, c.Load([]byte(`{"app":{"port":80}}`), JSONUnmarshaller))
+	assert.Equal(t, 80, c.GetInt("app.port"))
+	assert.Equal(t, "default.log", c.GetString("logger.name"))
+}
+
+func TestConfiguration_ParseFlagsError(t *testing.T) {
+	c := New()
+	c.BindFlags(IntFlag{Name: "port"})
+	c.FlagSet().SetOutput(ioutil.Discard)
+	assert.Error(t, c.ParseFlags([]string{"--port=abc"}))
+	assert.Error(t, c.ParseFlags([]string{"--unknown"}))
+}
@@ -0,0 +1,247 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// placeholderRegexp matches ${env:NAME}, ${file:/path}, ${other.key}
+// and the escaped form $${...}, a default can be given by ${...:-default}.
+var placeholderRegexp = regexp.MustCompile(`\$?\$\{([^{}]+)\}`)
+
+var (
+	// ErrUnresolved ...
+	ErrUnresolved = errors.New("unresolved placeholder")
+	// ErrCircularReference ...
+	ErrCircularReference = errors.New("circular reference")
+)
+
+// resolver expands placeholders in configuration values.
+type resolver struct {
+	// lookup returns the raw value of key
+	lookup func(key string) (interface{}, bool)
+	// stack keys being resolved, for cycle detection
+	stack []string
+	// decryptor decrypts ENC(...) values, may be nil
+	decryptor Decryptor
+	// secret is set once an encrypted value has been decrypted
+	secret bool
+}
+
+// resolve returns val with all placeholders expanded, maps and slices
+// containing placeholders are copied.
+func (r *resolver) resolve(val interface{}) (interface{}, error) {
+	if !resolvable(val) {
+		return val, nil
+	}
+
+	switch vv := val.(type) {
+	case string:
+		return r.resolveString(vv)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, item := range vv {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(vv))
+		for i, item := range vv {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = resolved
+		}
+		return s, nil
+	default:
+		return val, nil
+	}
+}
+
+func (r *resolver) resolveString(s string) (interface{}, error) {
+	if isEncrypted(s) {
+		r.secret = true
+		return decrypt(r.decryptor, s)
+	}
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	// 整个值只有一个引用时保留被引用值的类型
+	loc := placeholderRegexp.FindStringSubmatchIndex(s)
+	if loc != nil && loc[0] == 0 && loc[1] == len(s) && !strings.HasPrefix(s, "$$") {
+		return r.expand(s[loc[2]:loc[3]])
+	}
+
+	var err error
+	out := placeholderRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return match
+		}
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		var val interface{}
+		if val, err = r.expand(match[2 : len(match)-1]); err != nil {
+			return match
+		}
+		return fmt.Sprint(val)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// expand resolves the expression inside ${}.
+func (r *resolver) expand(expr string) (interface{}, error) {
+	def, hasDefault := "", false
+	if idx := strings.Index(expr, ":-"); idx >= 0 {
+		expr, def, hasDefault = expr[:idx], expr[idx+2:], true
+	}
+
+	switch {
+	case strings.HasPrefix(expr, "env:"):
+		if val, ok := os.LookupEnv(expr[len("env:"):]); ok {
+			return val, nil
+		}
+	case strings.HasPrefix(expr, "file:"):
+		content, err := ioutil.ReadFile(expr[len("file:"):])
+		if err == nil {
+			return strings.TrimRight(string(content), "\r\n"), nil
+		}
+		if !hasDefault {
+			return nil, errors.Wrapf(err, "resolve ${%s}", expr)
+		}
+	default:
+		for _, key := range r.stack {
+			if key == expr {
+				return nil, errors.Wrapf(ErrCircularReference, "%s -> %s", strings.Join(r.stack, " -> "), expr)
+			}
+		}
+		if val, ok := r.lookup(expr); ok {
+			r.stack = append(r.stack, expr)
+			defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+			return r.resolve(val)
+		}
+	}
+
+	if hasDefault {
+		return def, nil
+	}
+	return nil, errors.Wrapf(ErrUnresolved, "${%s}", expr)
+}
+
+// resolvable reports whether val contains placeholders or encrypted values.
+func resolvable(val interface{}) bool {
+	switch vv := val.(type) {
+	case string:
+		return strings.Contains(vv, "${") || isEncrypted(vv)
+	case map[string]interface{}:
+		for _, item := range vv {
+			if resolvable(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range vv {
+			if resolvable(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveValue expands placeholders and decrypts encrypted values in val, key is the key val belongs to.
+func (st *state) resolveValue(key string, val interface{}) (interface{}, error) {
+	return newResolver(st.lookupRaw, st.decryptor, key).resolveKey(key, val)
+}
+
+func newResolver(lookup func(string) (interface{}, bool), decryptor Decryptor, key string) *resolver {
+	r := &resolver{lookup: lookup, decryptor: decryptor}
+	if key != "" {
+		r.stack = []string{key}
+	}
+	return r
+}
+
+func (r *resolver) resolveKey(key string, val interface{}) (interface{}, error) {
+	resolved, err := r.resolve(val)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "key %s", key)
+	}
+	return resolved, nil
+}
+
+// GetE returns the value associated with the key with placeholders expanded,
+// an error is returned if a placeholder can not be resolved.
+func (c *Configuration) GetE(key string) (interface{}, error) {
+	key = c.key(key)
+	st := c.load()
+	return st.resolveValue(key, st.find(key))
+}
+
+// Traverse returns the flattened configuration joined by sep with placeholders expanded,
+// values failed to resolve are returned as is, secret values are redacted.
+func (c *Configuration) Traverse(sep string) map[string]interface{} {
+	st := c.load()
+	data := st.traverse(sep)
+	if c.prefix == "" {
+		return st.resolveFlat(data, sep, true)
+	}
+
+	prefix := strings.Replace(c.prefix, st.keyDelim, sep, -1) + sep
+	for key := range data {
+		if !strings.HasPrefix(key, prefix) {
+			delete(data, key)
+		}
+	}
+	sub := make(map[string]interface{}, len(data))
+	for key, val := range st.resolveFlat(data, sep, true) {
+		sub[key[len(prefix):]] = val
+	}
+	return sub
+}
+
+// resolveFlat expands placeholders in the values of a flattened view joined by sep,
+// secret values are redacted if redact is set, otherwise they are kept unresolved.
+func (st *state) resolveFlat(data map[string]interface{}, sep string, redact bool) map[string]interface{} {
+	for key, val := range data {
+		r := newResolver(st.lookupRaw, st.decryptor, strings.Replace(key, sep, st.keyDelim, -1))
+		resolved, err := r.resolveKey(key, val)
+		switch {
+		case redact && r.secret:
+			data[key] = redacted
+		case r.secret:
+			// 保留密文, 密文变化时仍能产生变更, 且明文不会出现在变更中
+		case err == nil:
+			data[key] = resolved
+		}
+	}
+	return data
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Interpolate(t *testing.T) {
+	setenv(t, "SPARROW_TEST_HOME", "/home/sparrow")
+
+	dir, err := ioutil.TempDir("", "conf-interpolate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "db")
+	require.NoError(t, ioutil.WriteFile(secret, []byte("s3cret\n"), 0600))
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{
+		"home": "${env:SPARROW_TEST_HOME}/data",
+		"db": {"password": "${file:`+secret+`}", "port": 3306},
+		"app": {"port": "${db.port}", "dsn": "root:${db.password}@tcp(127.0.0.1:${db.port})"},
+		"mode": "${env:SPARROW_TEST_MISSING:-dev}",
+		"literal": "$${env:SPARROW_TEST_HOME}"
+	}`), JSONUnmarshaller))
+
+	assert.Equal(t, "/home/sparrow/data", c.GetString("home"))
+	assert.Equal(t, "s3cret", c.GetString("db.password"))
+	// a single reference keeps the type of the referenced value
+	assert.Equal(t, float64(3306), c.Get("app.port"))
+	assert.Equal(t, 3306, c.GetInt("app.port"))
+	assert.Equal(t, "root:s3cret@tcp(127.0.0.1:3306)", c.GetString("app.dsn"))
+	assert.Equal(t, "dev", c.GetString("mode"))
+	assert.Equal(t, "${env:SPARROW_TEST_HOME}", c.GetString("literal"))
+
+	var app struct {
+		Port int
+		DSN  string
+	}
+	require.NoError(t, c.UnmarshalKey("app", &app))
+	assert.Equal(t, 3306, app.Port)
+	assert.Equal(t, "root:s3cret@tcp(127.0.0.1:3306)", app.DSN)
+
+	flat := c.Traverse(".")
+	assert.Equal(t, "/home/sparrow/data", flat["home"])
+	assert.Equal(t, "s3cret", flat["db.password"])
+}
+
+func TestConfiguration_InterpolateError(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{
+		"a": "${b}", "b": "${c}", "c": "${a}",
+		"missing": "${env:SPARROW_TEST_MISSING}",
+		"nofile": "${file:/nonexistent/sparrow}"
+	}`), JSONUnmarshaller))
+
+	_, err := c.GetE("a")
+	assert.True(t, errors.Is(err, ErrCircularReference))
+	assert.Contains(t, err.Error(), "a -> b -> c -> a")
+
+	_, err = c.GetE("missing")
+	assert.True(t, errors.Is(err, ErrUnresolved))
+	assert.Contains(t, err.Error(), "${env:SPARROW_TEST_MISSING}")
+
+	_, err = c.GetE("nofile")
+	assert.Error(t, err)
+
+	// Get falls back to the raw value
+	assert.Equal(t, "${env:SPARROW_TEST_MISSING}", c.GetString("missing"))
+	assert.Equal(t, "${env:SPARROW_TEST_MISSING}", c.Traverse(".")["missing"])
+
+	var val struct{ Missing string }
+	assert.Error(t, c.UnmarshalKey("", &val))
+}
+
+func TestConfiguration_InterpolateChange(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"localhost"},"app":{"addr":"${db.host}:3306"}}`), JSONUnmarshaller))
+
+	var changes []Change
+	cancel := c.Watch("app", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancel()
+
+	require.NoError(t, c.Set("db.host", "10.0.0.1"))
+	assert.Equal(t, "10.0.0.1:3306", c.GetString("app.addr"))
+	require.Len(t, changes, 1)
+	assert.Equal(t, Change{Type: ChangeModified, Key: "app.addr", Old: "localhost:3306", New: "10.0.0.1:3306"}, changes[0])
+}
@@ -0,0 +1,319 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mesment/sparrow/pkg/util/xmap"
+	"github.com/pkg/errors"
+)
+
+// 内置配置层的优先级, 数值越大优先级越高
+const (
+	PriorityDefault = 0
+	PriorityFile    = 100
+	PriorityEnv     = 200
+	PriorityFlag    = 300
+	PriorityRemote  = 400
+	PriorityRuntime = 500
+)
+
+// 内置配置层名称, 文件层以"file:"加文件路径命名
+const (
+	LayerDefault    = "default"
+	LayerContent    = "content"
+	LayerDataSource = "datasource"
+	LayerEnv        = "env"
+	LayerFlag       = "flag"
+	LayerRuntime    = "runtime"
+)
+
+// layer is a named source of configuration, layers with higher priority
+// override lower ones, the later added layer wins on equal priority.
+type layer struct {
+	name     string
+	priority int
+	seq      uint64
+	data     map[string]interface{}
+	// strings 层中的值均为字符串, 如环境变量和KV存储, UnmarshalKey时转换为目标类型
+	strings bool
+	// fold 层中的key不区分大小写地匹配其他层中已有的key, 如环境变量覆盖 logger.maxSize
+	fold bool
+}
+
+// fileLayer returns the layer name of file path.
+func fileLayer(path string) string {
+	return "file:" + path
+}
+
+// dataSourceLayer returns the layer name of data source,
+// data sources implementing fmt.Stringer are named by String().
+func dataSourceLayer(ds DataSource) string {
+	if s, ok := ds.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return LayerDataSource
+}
+
+// SetLayer adds layer name or replaces its content and priority.
+func (c *Configuration) SetLayer(name string, priority int, data map[string]interface{}) {
+	data = c.insensitivise(c.nest(normalize(xmap.CloneStringMap(data)).(map[string]interface{})))
+	c.update(func() {
+		c.setLayer(name, priority, data)
+	})
+}
+
+// RemoveLayer drops layer name, returns false if the layer not exists.
+func (c *Configuration) RemoveLayer(name string) bool {
+	var removed bool
+	c.update(func() {
+		for i, l := range c.layers {
+			if l.name == name {
+				c.layers = append(c.layers[:i], c.layers[i+1:]...)
+				removed = true
+				return
+			}
+		}
+	})
+	return removed
+}
+
+// Layers returns layer names ordered from the lowest to the highest priority.
+func (c *Configuration) Layers() []string {
+	st := c.load()
+	names := make([]string, 0, len(st.layers))
+	for _, l := range st.layers {
+		names = append(names, l.name)
+	}
+	return names
+}
+
+// Source returns the name of the layer providing the value of key,
+// e.g. "file:/etc/app.yaml", returns "" if key not exists.
+func (c *Configuration) Source(key string) string {
+	return c.load().source(c.key(key))
+}
+
+// SetDefault sets the default value for key, it has the lowest priority.
+func (c *Configuration) SetDefault(key string, val interface{}) {
+	key = c.key(key)
+	c.update(func() {
+		c.setPath(c.lazyLayer(LayerDefault, PriorityDefault), key, val)
+	})
+}
+
+// lazyLayer returns layer name, creates it if not exists, must be called with mu held.
+func (c *Configuration) lazyLayer(name string, priority int) *layer {
+	for _, l := range c.layers {
+		if l.name == name {
+			return l
+		}
+	}
+	return c.setLayer(name, priority, make(map[string]interface{}))
+}
+
+// setLayer must be called with mu held.
+func (c *Configuration) setLayer(name string, priority int, data map[string]interface{}) *layer {
+	for i, l := range c.layers {
+		if l.name == name {
+			c.layers = append(c.layers[:i], c.layers[i+1:]...)
+			break
+		}
+	}
+
+	c.layerSeq++
+	l := &layer{name: name, priority: priority, seq: c.layerSeq, data: data}
+	c.layers = append(c.layers, l)
+	sort.SliceStable(c.layers, func(i, j int) bool {
+		if c.layers[i].priority != c.layers[j].priority {
+			return c.layers[i].priority < c.layers[j].priority
+		}
+		return c.layers[i].seq < c.layers[j].seq
+	})
+	return l
+}
+
+// setPath sets val at key in layer, must be called with mu held.
+func (c *Configuration) setPath(l *layer, key string, val interface{}) {
+	if c.caseInsensitive {
+		key = strings.ToLower(key)
+		if m, ok := val.(map[string]interface{}); ok {
+			val = c.insensitivise(xmap.CloneStringMap(m))
+		}
+	}
+	l.data = deepSet(l.data, splitKey(key, c.keyDelim), val).(map[string]interface{})
+}
+
+// insensitivise lowercases the keys of data in case insensitive mode.
+func (c *Configuration) insensitivise(data map[string]interface{}) map[string]interface{} {
+	if c.caseInsensitive {
+		xmap.InsensitiviseMap(data)
+	}
+	return data
+}
+
+// merge returns the merged view of all layers, must be called with mu held.
+func (c *Configuration) merge() map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, l := range c.layers {
+		overlay(merged, l.data, l.fold)
+	}
+	return merged
+}
+
+// overlay writes src onto dst, unlike xmap.MergeStringMap values of
+// different types are overridden as well. If fold is set, keys of src
+// override the keys of dst differing only in case.
+func overlay(dst, src map[string]interface{}, fold bool) {
+	for key, sv := range src {
+		if fold {
+			key = foldKey(dst, key)
+		}
+		dst[key] = overlayValue(dst[key], sv, fold)
+	}
+}
+
+// foldKey returns the key of m matching key case insensitively, key itself if none.
+func foldKey(m map[string]interface{}, key string) string {
+	if _, ok := m[key]; ok {
+		return key
+	}
+	match := key
+	for k := range m {
+		if strings.EqualFold(k, key) && (match == key || k < match) {
+			match = k
+		}
+	}
+	return match
+}
+
+// overlayValue returns sv written onto dv, a map keyed by indices, e.g. from
+// Set("servers.0.host") or env SPARROW_SERVERS_0_HOST, overrides the elements of a slice.
+func overlayValue(dv, sv interface{}, fold bool) interface{} {
+	sm, ok := sv.(map[string]interface{})
+	if !ok {
+		return xmap.Clone(sv)
+	}
+	switch dd := dv.(type) {
+	case map[string]interface{}:
+		overlay(dd, sm, fold)
+		return dd
+	case []interface{}:
+		if indices, ok := sliceIndices(sm); ok {
+			for _, idx := range indices {
+				// 只允许覆盖已有元素或追加到末尾
+				if idx > len(dd) {
+					break
+				}
+				if idx == len(dd) {
+					dd = append(dd, nil)
+				}
+				dd[idx] = overlayValue(dd[idx], sm[strconv.Itoa(idx)], fold)
+			}
+			return dd
+		}
+	}
+	dm := make(map[string]interface{}, len(sm))
+	overlay(dm, sm, fold)
+	return dm
+}
+
+// sliceIndices returns the sorted keys of m if they are all indices.
+func sliceIndices(m map[string]interface{}) ([]int, bool) {
+	indices := make([]int, 0, len(m))
+	for key := range m {
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 || strconv.Itoa(idx) != key {
+			return nil, false
+		}
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	return indices, len(indices) > 0
+}
+
+// splitKey splits key by delim, index brackets are accepted: servers[0].host => servers, 0, host.
+func splitKey(key, delim string) []string {
+	return strings.Split(normalizeKey(key, delim), delim)
+}
+
+// normalizeKey rewrites index brackets to segments: servers[0].host => servers.0.host.
+func normalizeKey(key, delim string) string {
+	if !strings.Contains(key, "[") {
+		return key
+	}
+	return strings.TrimPrefix(indexRegexp.ReplaceAllString(key, delim+"$1"), delim)
+}
+
+var indexRegexp = regexp.MustCompile(`\[(\d+)\]`)
+
+// checkIndex returns ErrIndexOutOfRange if key addresses an element beyond the end of a slice in the merged tree.
+func (st *state) checkIndex(key string) error {
+	var val interface{} = st.tree
+	for _, seg := range splitKey(key, st.keyDelim) {
+		switch vv := val.(type) {
+		case map[string]interface{}:
+			val = vv[seg]
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx == len(vv) {
+				// 非下标的key将数组替换为map, 等于长度时追加
+				return nil
+			}
+			if idx > len(vv) {
+				return errors.Wrapf(ErrIndexOutOfRange, "%s: index %d, length %d", key, idx, len(vv))
+			}
+			val = vv[idx]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func searchPath(m map[string]interface{}, paths []string) (interface{}, bool) {
+	return searchPathFold(m, paths, false)
+}
+
+// searchPathFold is searchPath matching the keys of maps case insensitively if fold is set.
+func searchPathFold(m map[string]interface{}, paths []string, fold bool) (interface{}, bool) {
+	var val interface{} = m
+	for _, key := range paths {
+		switch vv := val.(type) {
+		case map[string]interface{}:
+			if fold {
+				key = foldKey(vv, key)
+			}
+			var ok bool
+			if val, ok = vv[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(vv) {
+				return nil, false
+			}
+			val = vv[idx]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
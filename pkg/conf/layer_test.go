@@ -0,0 +1,152 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Layers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("db:\n  dsn: file-dsn\n  pool: 10\n"), 0644))
+
+	setenv(t, "SPARROW_TEST_DB_POOL", "20")
+
+	c := New()
+	c.SetDefault("db.timeout", "1s")
+	c.SetDefault("db.pool", 5)
+	require.NoError(t, c.LoadFromFile(path))
+	c.LoadFromEnv("SPARROW_TEST_")
+	c.SetLayer("remote:etcd", PriorityRemote, map[string]interface{}{
+		"db": map[string]interface{}{"dsn": "remote-dsn"},
+	})
+
+	assert.Equal(t, []string{LayerDefault, "file:" + path, LayerEnv, "remote:etcd"}, c.Layers())
+	assert.Equal(t, "remote-dsn", c.GetString("db.dsn"))
+	assert.Equal(t, "remote:etcd", c.Source("db.dsn"))
+	assert.Equal(t, 20, c.GetInt("db.pool"))
+	assert.Equal(t, LayerEnv, c.Source("db.pool"))
+	assert.Equal(t, "1s", c.GetString("db.timeout"))
+	assert.Equal(t, LayerDefault, c.Source("db.timeout"))
+	assert.Equal(t, "", c.Source("db.unknown"))
+
+	require.NoError(t, c.Set("db.dsn", "runtime-dsn"))
+	assert.Equal(t, "runtime-dsn", c.GetString("db.dsn"))
+	assert.Equal(t, LayerRuntime, c.Source("db.dsn"))
+
+	// dropping layers falls back to the lower ones
+	assert.True(t, c.RemoveLayer(LayerRuntime))
+	assert.True(t, c.RemoveLayer("remote:etcd"))
+	assert.False(t, c.RemoveLayer("remote:etcd"))
+	assert.Equal(t, "file-dsn", c.GetString("db.dsn"))
+	assert.Equal(t, "file:"+path, c.Source("db.dsn"))
+
+	// replacing a layer drops the keys missing from the new content
+	c.SetLayer("file:"+path, PriorityFile, map[string]interface{}{
+		"db": map[string]interface{}{"pool": 10},
+	})
+	assert.Nil(t, c.Get("db.dsn"))
+	assert.Equal(t, 20, c.GetInt("db.pool"))
+}
+
+func TestConfiguration_LayerPriority(t *testing.T) {
+	c := New()
+	c.SetLayer("b", PriorityFile, map[string]interface{}{"key": "b"})
+	c.SetLayer("a", PriorityRemote, map[string]interface{}{"key": "a"})
+	c.SetLayer("c", PriorityFile, map[string]interface{}{"key": "c"})
+	assert.Equal(t, []string{"b", "c", "a"}, c.Layers())
+	assert.Equal(t, "a", c.GetString("key"))
+
+	c.RemoveLayer("a")
+	// the later added layer wins on equal priority
+	assert.Equal(t, "c", c.GetString("key"))
+}
+
+func TestConfiguration_LoadWithLayer(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"a":{"b":1}}`), JSONUnmarshaller))
+	require.NoError(t, c.Load([]byte(`{"a":{"c":2}}`), JSONUnmarshaller))
+	require.NoError(t, c.Load([]byte(`{"a":{"b":3}}`), JSONUnmarshaller, WithLayer("remote", PriorityRemote)))
+
+	assert.Equal(t, 3, c.GetInt("a.b"))
+	assert.Equal(t, 2, c.GetInt("a.c"))
+	assert.Equal(t, LayerContent, c.Source("a.c"))
+	assert.Equal(t, "remote", c.Source("a.b"))
+}
+
+func TestConfiguration_ArrayIndex(t *testing.T) {
+	setenv(t, "SPARROW_TEST_SERVERS_1_PORT", "9091")
+
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"servers":[{"host":"a","port":8080},{"host":"b","port":8081}],"hosts":["x","y"],"empty":[]}`), JSONUnmarshaller))
+	c.LoadFromEnv("SPARROW_TEST_")
+
+	assert.Equal(t, "a", c.GetString("servers.0.host"))
+	assert.Equal(t, "b", c.GetString("servers[1].host"))
+	assert.Equal(t, 9091, c.GetInt("servers.1.port"))
+	assert.Equal(t, LayerEnv, c.Source("servers[1].port"))
+	assert.Equal(t, "y", c.GetString("hosts[1]"))
+	assert.Nil(t, c.Get("servers.2.host"))
+	assert.Equal(t, "b", c.Sub("servers.1").GetString("host"))
+
+	flat := c.Traverse(".")
+	assert.Equal(t, "a", flat["servers.0.host"])
+	assert.Equal(t, "9091", flat["servers.1.port"])
+	assert.Equal(t, "x", flat["hosts.0"])
+	assert.Equal(t, []interface{}{}, flat["empty"])
+	assert.NotContains(t, flat, "servers")
+
+	var changes []Change
+	cancel := c.Watch("servers[0]", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancel()
+
+	require.NoError(t, c.Set("servers[0].host", "c"))
+	require.NoError(t, c.Set("servers.2.host", "d"))
+	assert.Equal(t, "c", c.GetString("servers.0.host"))
+	assert.Equal(t, "d", c.GetString("servers.2.host"))
+	assert.Equal(t, []Change{{Type: ChangeModified, Key: "servers.0.host", Old: "a", New: "c"}}, changes)
+
+	var servers []struct {
+		Host string
+		Port int
+	}
+	require.NoError(t, c.UnmarshalKey("servers", &servers))
+	require.Len(t, servers, 3)
+	assert.Equal(t, "c", servers[0].Host)
+	assert.Equal(t, 9091, servers[1].Port)
+	assert.Equal(t, "d", servers[2].Host)
+
+	// out of range indices are rejected
+	changes = nil
+	err := c.Set("servers.5.host", "e")
+	assert.True(t, errors.Is(err, ErrIndexOutOfRange), "%v", err)
+	assert.Len(t, c.GetSlice("servers"), 3)
+	assert.Nil(t, c.Get("servers.5.host"))
+	assert.Equal(t, "", c.Source("servers.5.host"))
+	assert.Equal(t, LayerRuntime, c.Source("servers.2.host"))
+	assert.Empty(t, changes)
+}
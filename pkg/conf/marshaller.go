@@ -0,0 +1,70 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Marshaller ...
+type Marshaller = func(interface{}) ([]byte, error)
+
+var (
+	// JSONMarshaller ...
+	JSONMarshaller Marshaller = func(v interface{}) ([]byte, error) {
+		content, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(content, '\n'), nil
+	}
+	// YAMLMarshaller ...
+	YAMLMarshaller Marshaller = yaml.Marshal
+	// TOMLMarshaller ...
+	TOMLMarshaller Marshaller = func(v interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+)
+
+var marshallers = map[string]Marshaller{
+	FormatJSON: JSONMarshaller,
+	FormatYAML: YAMLMarshaller,
+	"yml":      YAMLMarshaller,
+	FormatTOML: TOMLMarshaller,
+}
+
+// RegisterMarshaller registers marshaller for format or file extension(without dot).
+func RegisterMarshaller(format string, marshaller Marshaller) {
+	marshallers[strings.ToLower(format)] = marshaller
+}
+
+// MarshallerFor returns marshaller for format or file extension.
+func MarshallerFor(format string) (Marshaller, error) {
+	marshaller, ok := marshallers[strings.TrimPrefix(strings.ToLower(format), ".")]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownFormat, format)
+	}
+	return marshaller, nil
+}
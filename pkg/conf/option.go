@@ -14,16 +14,38 @@
 
 package conf
 
+// Option ...
+type (
+	Option  func(o *Options)
+	Options struct {
+		// CaseInsensitive key不区分大小写, 所有key统一转为小写
+		CaseInsensitive bool
+	}
+)
+
+// CaseInsensitive 设置key不区分大小写, Logger.Level 与 logger.level 为同一个key
+func CaseInsensitive() Option {
+	return func(o *Options) {
+		o.CaseInsensitive = true
+	}
+}
+
 // GetOption ...
 type (
 	GetOption  func(o *GetOptions)
 	GetOptions struct {
 		TagName string
+		// DefaultTagName 默认值tag, 配置中缺失的字段使用该tag的值, 为空时不处理
+		DefaultTagName string
+		// ValidateTagName 校验规则tag, 支持 required,omitempty,min=1,max=65535,len=3,oneof=a b c, 其他规则忽略, 为空时不校验
+		ValidateTagName string
 	}
 )
 
 var defaultGetOptions = GetOptions{
-	TagName: "mapstructure",
+	TagName:         "mapstructure",
+	DefaultTagName:  "default",
+	ValidateTagName: "validate",
 }
 
 // 设置Tag
@@ -32,3 +54,75 @@ func TagName(tag string) GetOption {
 		o.TagName = tag
 	}
 }
+
+// 设置默认值Tag
+func DefaultTagName(tag string) GetOption {
+	return func(o *GetOptions) {
+		o.DefaultTagName = tag
+	}
+}
+
+// 设置校验规则Tag
+func ValidateTagName(tag string) GetOption {
+	return func(o *GetOptions) {
+		o.ValidateTagName = tag
+	}
+}
+
+// LoadOption ...
+type (
+	LoadOption  func(o *LoadOptions)
+	LoadOptions struct {
+		// Layer 加载到的配置层名称
+		Layer string
+		// Priority 配置层优先级
+		Priority int
+		// StringValues 配置层中的值均为字符串, 如KV存储, UnmarshalKey时转换为目标类型
+		StringValues bool
+	}
+)
+
+// WithLayer 设置加载到的配置层及其优先级
+func WithLayer(name string, priority int) LoadOption {
+	return func(o *LoadOptions) {
+		o.Layer = name
+		o.Priority = priority
+	}
+}
+
+// WithStringValues 标记加载的配置层只包含字符串值, UnmarshalKey时按目标类型转换, 如"8080"转为int
+func WithStringValues() LoadOption {
+	return func(o *LoadOptions) {
+		o.StringValues = true
+	}
+}
+
+// WriteOption ...
+type (
+	WriteOption  func(o *WriteOptions)
+	WriteOptions struct {
+		// Format 输出格式, 为空时根据文件后缀判断
+		Format string
+		// Layer 只输出指定的配置层, 为空时输出合并后的配置
+		Layer string
+	}
+)
+
+// WriteFormat 设置输出格式: json, yaml, toml
+func WriteFormat(format string) WriteOption {
+	return func(o *WriteOptions) {
+		o.Format = format
+	}
+}
+
+// WriteLayer 只输出指定配置层的内容, 层不存在时返回ErrLayerNotFound
+func WriteLayer(name string) WriteOption {
+	return func(o *WriteOptions) {
+		o.Layer = name
+	}
+}
+
+// WriteChangedOnly 只输出通过Set修改过的配置, 从未调用Set时返回ErrLayerNotFound
+func WriteChangedOnly() WriteOption {
+	return WriteLayer(LayerRuntime)
+}
@@ -0,0 +1,477 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// descriptionTag is the struct tag describing a field in the generated documents.
+const descriptionTag = "description"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaEntry is a config struct registered under key.
+type schemaEntry struct {
+	key     string
+	typ     reflect.Type
+	options GetOptions
+}
+
+// schemaNode describes a key, its children are the fields of a struct,
+// elem is the element of a slice or map.
+type schemaNode struct {
+	name     string
+	typ      reflect.Type
+	kind     string
+	def      string
+	hasDef   bool
+	desc     string
+	rules    []string
+	children []*schemaNode
+	elem     *schemaNode
+}
+
+// SchemaField describes a key in the generated reference.
+type SchemaField struct {
+	// Key 配置路径, 数组元素以[]表示, 如 servers[].host
+	Key         string
+	Type        string
+	Default     string
+	Description string
+	// Rules validate tag中的校验规则
+	Rules string
+}
+
+// RegisterSchema registers the config struct decoded from key, the same one passed to UnmarshalKey,
+// fields are documented by the default, validate and description tags. Registering key again replaces it.
+func (c *Configuration) RegisterSchema(key string, val interface{}, opts ...GetOption) {
+	var options = defaultGetOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	entry := &schemaEntry{key: c.key(key), typ: indirectType(reflect.TypeOf(val)), options: options}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, item := range c.schemas {
+		if item.key == entry.key {
+			c.schemas[i] = entry
+			return
+		}
+	}
+	c.schemas = append(c.schemas, entry)
+}
+
+// JSONSchema returns the JSON Schema (draft-07) of the registered structs.
+func (c *Configuration) JSONSchema() ([]byte, error) {
+	schema := c.schemaTree().jsonSchema()
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// SchemaFields returns every key of the registered structs in registration and field order.
+func (c *Configuration) SchemaFields() []SchemaField {
+	var fields []SchemaField
+	for _, child := range c.schemaTree().children {
+		child.fields(child.name, &fields)
+	}
+	return fields
+}
+
+// MarkdownDoc returns a Markdown reference table of the registered keys.
+func (c *Configuration) MarkdownDoc() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("| Key | Type | Default | Rules | Description |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, field := range c.SchemaFields() {
+		def := ""
+		if field.Default != "" {
+			def = "`" + field.Default + "`"
+		}
+		fmt.Fprintf(&buf, "| `%s` | %s | %s | %s | %s |\n", field.Key, field.Type, def,
+			markdownEscape(field.Rules), markdownEscape(field.Description))
+	}
+	return buf.Bytes()
+}
+
+// YAMLDoc returns a sample YAML configuration of the registered keys filled with
+// defaults, descriptions and rules are written as comments.
+func (c *Configuration) YAMLDoc() []byte {
+	var buf bytes.Buffer
+	for _, child := range c.schemaTree().children {
+		child.writeYAML(&buf, 0)
+	}
+	return buf.Bytes()
+}
+
+// schemaTree builds the tree of all the registered structs.
+func (c *Configuration) schemaTree() *schemaNode {
+	c.mu.Lock()
+	entries := append([]*schemaEntry(nil), c.schemas...)
+	delim := c.keyDelim
+	c.mu.Unlock()
+
+	root := &schemaNode{kind: "object"}
+	for _, entry := range entries {
+		node := buildSchemaNode(entry.typ, entry.options, nil)
+		if entry.key == "" {
+			root.children = append(root.children, node.children...)
+			continue
+		}
+
+		parent := root
+		paths := strings.Split(entry.key, delim)
+		for _, path := range paths[:len(paths)-1] {
+			parent = parent.child(path)
+		}
+		node.name = paths[len(paths)-1]
+		parent.replace(node)
+	}
+	return root
+}
+
+// child returns the object child name, creates it if not exists.
+func (n *schemaNode) child(name string) *schemaNode {
+	for _, child := range n.children {
+		if child.name == name && child.kind == "object" {
+			return child
+		}
+	}
+	child := &schemaNode{name: name, kind: "object"}
+	n.replace(child)
+	return child
+}
+
+func (n *schemaNode) replace(node *schemaNode) {
+	for i, child := range n.children {
+		if child.name == node.name {
+			n.children[i] = node
+			return
+		}
+	}
+	n.children = append(n.children, node)
+}
+
+// buildSchemaNode describes typ, visiting holds the structs being built to stop on recursive types.
+func buildSchemaNode(typ reflect.Type, options GetOptions, visiting []reflect.Type) *schemaNode {
+	typ = indirectType(typ)
+	node := &schemaNode{typ: typ}
+
+	switch {
+	case typ == durationType:
+		node.kind = "duration"
+		return node
+	case typ == timeType:
+		node.kind = "string"
+		return node
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		node.kind = "string"
+	case reflect.Bool:
+		node.kind = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		node.kind = "integer"
+	case reflect.Float32, reflect.Float64:
+		node.kind = "number"
+	case reflect.Slice, reflect.Array:
+		node.kind = "array"
+		node.elem = buildSchemaNode(typ.Elem(), options, visiting)
+	case reflect.Map:
+		node.kind = "map"
+		node.elem = buildSchemaNode(typ.Elem(), options, visiting)
+	case reflect.Struct:
+		node.kind = "object"
+		for _, t := range visiting {
+			if t == typ {
+				return node
+			}
+		}
+		node.children = structFields(typ, options, append(visiting, typ))
+	default:
+		node.kind = "any"
+	}
+	return node
+}
+
+func structFields(typ reflect.Type, options GetOptions, visiting []reflect.Type) []*schemaNode {
+	var children []*schemaNode
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key, squash, ok := fieldKey(field, options.TagName)
+		if !ok || field.PkgPath != "" && !squash {
+			continue
+		}
+		if squash {
+			children = append(children, structFields(indirectType(field.Type), options, visiting)...)
+			continue
+		}
+
+		child := buildSchemaNode(field.Type, options, visiting)
+		child.name = key
+		if name := strings.Split(field.Tag.Get(options.TagName), ",")[0]; name == "" {
+			// mapstructure不区分大小写, 未设置tag的字段在配置文件中通常使用小写
+			child.name = strings.ToLower(key)
+		}
+		child.def, child.hasDef = field.Tag.Lookup(options.DefaultTagName)
+		child.desc = field.Tag.Get(descriptionTag)
+		if rules := field.Tag.Get(options.ValidateTagName); options.ValidateTagName != "" && rules != "" {
+			for _, rule := range strings.Split(rules, ",") {
+				if rule = strings.TrimSpace(rule); rule != "" {
+					child.rules = append(child.rules, rule)
+				}
+			}
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// typeName returns the type shown in the documents.
+func (n *schemaNode) typeName() string {
+	switch n.kind {
+	case "array":
+		return "[]" + n.elem.typeName()
+	case "map":
+		return "map[string]" + n.elem.typeName()
+	default:
+		return n.kind
+	}
+}
+
+func (n *schemaNode) jsonSchema() map[string]interface{} {
+	schema := make(map[string]interface{})
+	switch n.kind {
+	case "object":
+		schema["type"] = "object"
+		properties := make(map[string]interface{}, len(n.children))
+		var required []string
+		for _, child := range n.children {
+			properties[child.name] = child.jsonSchema()
+			// 有默认值的字段可以省略
+			if child.hasRule("required") && !child.hasDef {
+				required = append(required, child.name)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	case "array":
+		schema["type"] = "array"
+		schema["items"] = n.elem.jsonSchema()
+	case "map":
+		schema["type"] = "object"
+		schema["additionalProperties"] = n.elem.jsonSchema()
+	case "duration":
+		schema["type"] = "string"
+		schema["format"] = "duration"
+	case "any":
+	default:
+		schema["type"] = n.kind
+	}
+
+	if n.desc != "" {
+		schema["description"] = n.desc
+	}
+	if n.hasDef {
+		schema["default"] = n.value(n.def)
+	}
+	for _, rule := range n.rules {
+		n.applyRule(schema, rule)
+	}
+	return schema
+}
+
+func (n *schemaNode) hasRule(name string) bool {
+	for _, rule := range n.rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRule translates a validate rule into JSON Schema keywords.
+func (n *schemaNode) applyRule(schema map[string]interface{}, rule string) {
+	name, param := rule, ""
+	if idx := strings.Index(rule, "="); idx >= 0 {
+		name, param = rule[:idx], rule[idx+1:]
+	}
+
+	switch name {
+	case "oneof":
+		var enum []interface{}
+		for _, option := range strings.Fields(param) {
+			enum = append(enum, n.value(option))
+		}
+		schema["enum"] = enum
+	case "min", "max", "len":
+		if n.kind == "duration" {
+			return
+		}
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		keywords := map[string][2]string{
+			"integer": {"minimum", "maximum"},
+			"number":  {"minimum", "maximum"},
+			"string":  {"minLength", "maxLength"},
+			"array":   {"minItems", "maxItems"},
+			"map":     {"minProperties", "maxProperties"},
+		}[n.kind]
+		if keywords[0] == "" {
+			return
+		}
+		if name != "max" {
+			schema[keywords[0]] = limit
+		}
+		if name != "min" {
+			schema[keywords[1]] = limit
+		}
+	}
+}
+
+// value converts the text of a default or an enum option to the type of n.
+func (n *schemaNode) value(text string) interface{} {
+	switch n.kind {
+	case "array":
+		items := splitDefault(text)
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = n.elem.value(item)
+		}
+		return values
+	case "integer":
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(text); err == nil {
+			return v
+		}
+	}
+	return text
+}
+
+func (n *schemaNode) fields(key string, fields *[]SchemaField) {
+	switch {
+	case n.kind == "object" && len(n.children) > 0:
+		for _, child := range n.children {
+			child.fields(key+"."+child.name, fields)
+		}
+		return
+	case n.kind == "array" && n.elem.kind == "object" && len(n.elem.children) > 0:
+		n.elem.fields(key+"[]", fields)
+		return
+	}
+	*fields = append(*fields, SchemaField{
+		Key:         key,
+		Type:        n.typeName(),
+		Default:     n.def,
+		Description: n.desc,
+		Rules:       strings.Join(n.rules, ","),
+	})
+}
+
+func (n *schemaNode) writeYAML(buf *bytes.Buffer, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	if comment := n.comment(); comment != "" {
+		fmt.Fprintf(buf, "%s# %s\n", prefix, comment)
+	}
+
+	switch {
+	case n.kind == "object" && len(n.children) > 0:
+		fmt.Fprintf(buf, "%s%s:\n", prefix, n.name)
+		for _, child := range n.children {
+			child.writeYAML(buf, indent+2)
+		}
+	case n.kind == "array" && n.elem.kind == "object" && len(n.elem.children) > 0 && !n.hasDef:
+		fmt.Fprintf(buf, "%s%s:\n", prefix, n.name)
+		// 以一个元素示意数组元素的字段
+		var item bytes.Buffer
+		for _, child := range n.elem.children {
+			child.writeYAML(&item, indent+4)
+		}
+		lines := item.Bytes()
+		lines[indent+2] = '-'
+		buf.Write(lines)
+	default:
+		fmt.Fprintf(buf, "%s%s: %s\n", prefix, n.name, n.yamlValue())
+	}
+}
+
+func (n *schemaNode) comment() string {
+	comment := n.desc
+	if len(n.rules) > 0 {
+		comment = strings.TrimSpace(comment + " (" + strings.Join(n.rules, ",") + ")")
+	}
+	return comment
+}
+
+// yamlValue returns the default of n in YAML, or the zero value if n has no default.
+func (n *schemaNode) yamlValue() string {
+	var val interface{}
+	switch {
+	case n.hasDef && n.kind == "array":
+		// 以流式写在同一行, 如 [a, b]
+		var items []string
+		for _, item := range n.value(n.def).([]interface{}) {
+			out, err := yaml.Marshal(item)
+			if err != nil {
+				return ""
+			}
+			items = append(items, strings.TrimSpace(string(out)))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case n.hasDef:
+		val = n.value(n.def)
+	case n.kind == "duration":
+		val = "0s"
+	case n.kind == "array":
+		return "[]"
+	case n.kind == "map" || n.kind == "object":
+		return "{}"
+	case n.kind == "any":
+		return "null"
+	default:
+		val = reflect.Zero(n.typ).Interface()
+	}
+	out, err := yaml.Marshal(val)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func markdownEscape(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaDB struct {
+	DSN     string        `mapstructure:"dsn" validate:"required" description:"数据源"`
+	Timeout time.Duration `mapstructure:"timeout" default:"3s" description:"超时时间"`
+}
+
+type schemaServer struct {
+	Host   string            `mapstructure:"host" default:"localhost" description:"监听地址"`
+	Port   int               `mapstructure:"port" default:"8080" validate:"min=1,max=65535"`
+	Mode   string            `mapstructure:"mode" default:"dev" validate:"oneof=dev test prod"`
+	Tags   []string          `mapstructure:"tags" validate:"omitempty,max=2"`
+	Labels map[string]string `mapstructure:"labels"`
+	DB     schemaDB          `mapstructure:"db"`
+	Slaves []schemaDB        `mapstructure:"slaves"`
+}
+
+func TestConfiguration_JSONSchema(t *testing.T) {
+	c := New()
+	c.RegisterSchema("app.server", &schemaServer{})
+
+	out, err := c.JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &schema))
+	assert.Equal(t, "http://json-schema.org/draft-07/schema#", schema["$schema"])
+
+	server := schema["properties"].(map[string]interface{})["app"].(map[string]interface{})["properties"].(map[string]interface{})["server"].(map[string]interface{})
+	props := server["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"type": "string", "default": "localhost", "description": "监听地址",
+	}, props["host"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "integer", "default": float64(8080), "minimum": float64(1), "maximum": float64(65535),
+	}, props["port"])
+	assert.Equal(t, []interface{}{"dev", "test", "prod"}, props["mode"].(map[string]interface{})["enum"])
+	assert.Equal(t, float64(2), props["tags"].(map[string]interface{})["maxItems"])
+	assert.Equal(t, map[string]interface{}{"type": "string"}, props["labels"].(map[string]interface{})["additionalProperties"])
+
+	db := props["db"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"dsn"}, db["required"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "string", "format": "duration", "default": "3s", "description": "超时时间",
+	}, db["properties"].(map[string]interface{})["timeout"])
+	assert.Equal(t, db, props["slaves"].(map[string]interface{})["items"])
+}
+
+func TestConfiguration_SchemaDoc(t *testing.T) {
+	c := New()
+	c.RegisterSchema("server", schemaServer{})
+	sub := c.Sub("app")
+	sub.RegisterSchema("db", &schemaDB{})
+
+	assert.Equal(t, []SchemaField{
+		{Key: "server.host", Type: "string", Default: "localhost", Description: "监听地址"},
+		{Key: "server.port", Type: "integer", Default: "8080", Rules: "min=1,max=65535"},
+		{Key: "server.mode", Type: "string", Default: "dev", Rules: "oneof=dev test prod"},
+		{Key: "server.tags", Type: "[]string", Rules: "omitempty,max=2"},
+		{Key: "server.labels", Type: "map[string]string"},
+		{Key: "server.db.dsn", Type: "string", Description: "数据源", Rules: "required"},
+		{Key: "server.db.timeout", Type: "duration", Default: "3s", Description: "超时时间"},
+		{Key: "server.slaves[].dsn", Type: "string", Description: "数据源", Rules: "required"},
+		{Key: "server.slaves[].timeout", Type: "duration", Default: "3s", Description: "超时时间"},
+		{Key: "app.db.dsn", Type: "string", Description: "数据源", Rules: "required"},
+		{Key: "app.db.timeout", Type: "duration", Default: "3s", Description: "超时时间"},
+	}, c.SchemaFields())
+
+	assert.Contains(t, string(c.MarkdownDoc()), "| `server.port` | integer | `8080` | min=1,max=65535 |  |\n")
+
+	// the sample YAML is a valid configuration filled with defaults
+	doc := c.YAMLDoc()
+	assert.Contains(t, string(doc), "  # 监听地址\n  host: localhost\n")
+	require.NoError(t, c.Load(doc, YAMLUnmarshaller))
+	assert.Equal(t, 8080, c.Get("server.port"))
+	assert.Equal(t, "3s", c.Get("server.slaves[0].timeout"))
+	assert.Equal(t, "", c.Get("app.db.dsn"))
+
+	var server schemaServer
+	require.NoError(t, c.UnmarshalKey("server", &server, ValidateTagName("")))
+	assert.Equal(t, 3*time.Second, server.Slaves[0].Timeout)
+}
+
+func TestConfiguration_JSONSchemaUntagged(t *testing.T) {
+	type listen struct {
+		Port  int      `default:"8080" validate:"required"`
+		Host  string   `validate:"required"`
+		Hosts []string `default:"a,b"`
+	}
+	c := New()
+	c.RegisterSchema("server", listen{})
+
+	out, err := c.JSONSchema()
+	require.NoError(t, err)
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &schema))
+	server := schema["properties"].(map[string]interface{})["server"].(map[string]interface{})
+
+	// untagged fields are named the way files write them, defaulted fields are not required
+	assert.Contains(t, server["properties"], "port")
+	assert.Contains(t, server["properties"], "host")
+	assert.Equal(t, []interface{}{"host"}, server["required"])
+	assert.Equal(t, []interface{}{"a", "b"}, server["properties"].(map[string]interface{})["hosts"].(map[string]interface{})["default"])
+	assert.Contains(t, string(c.YAMLDoc()), "  hosts: [a, b]\n")
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"time"
+
+	"github.com/mesment/sparrow/pkg/util/xmap"
+	"github.com/pkg/errors"
+)
+
+// defaultHistorySize means the default number of snapshots kept
+const defaultHistorySize = 10
+
+// ErrSnapshotNotFound is returned by Rollback when the version is not in the history.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is an immutable copy of the merged configuration, a new version
+// is recorded every time the configuration changes.
+type Snapshot struct {
+	Version uint64
+	Time    time.Time
+
+	data     map[string]interface{}
+	flat     map[string]interface{}
+	layers   []*layer
+	keyDelim string
+}
+
+// Get returns a copy of the value associated with the key.
+func (s *Snapshot) Get(key string) interface{} {
+	val, _ := searchPath(s.data, splitKey(key, s.keyDelim))
+	return xmap.Clone(val)
+}
+
+// AllSettings returns a copy of the merged configuration tree.
+func (s *Snapshot) AllSettings() map[string]interface{} {
+	return xmap.CloneStringMap(s.data)
+}
+
+// Traverse returns the flattened configuration joined by sep, placeholders are not expanded.
+func (s *Snapshot) Traverse(sep string) map[string]interface{} {
+	data := make(map[string]interface{})
+	lookup("", xmap.CloneStringMap(s.data), data, sep)
+	return data
+}
+
+// Diff returns the changes from snapshot a to b keyed by the flattened keys,
+// a nil snapshot is treated as empty.
+func Diff(a, b *Snapshot) []Change {
+	var prev, next map[string]interface{}
+	if a != nil {
+		prev = a.flat
+	}
+	if b != nil {
+		next = b.flat
+	}
+	return diff(prev, next)
+}
+
+// Snapshot returns the snapshot of the current version.
+func (c *Configuration) Snapshot() *Snapshot {
+	history := c.load().history
+	return history[len(history)-1]
+}
+
+// Snapshots returns the snapshots kept in history, ordered from the oldest to the latest.
+func (c *Configuration) Snapshots() []*Snapshot {
+	return append([]*Snapshot(nil), c.load().history...)
+}
+
+// SetHistorySize sets the number of snapshots kept, 10 by default.
+func (c *Configuration) SetHistorySize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.historySize = n
+	next := *c.load()
+	next.history = c.trimHistory(next.history)
+	c.state.Store(&next)
+}
+
+// Rollback restores the layers of snapshot version, the restored configuration
+// is recorded as a new version and the changes are notified as usual.
+func (c *Configuration) Rollback(version uint64) error {
+	err := errors.Wrapf(ErrSnapshotNotFound, "version %d", version)
+	c.update(func() {
+		for _, s := range c.load().history {
+			if s.Version == version {
+				c.layers = cloneLayers(s.layers)
+				err = nil
+				return
+			}
+		}
+	})
+	return err
+}
+
+// record appends a snapshot of st to its history, must be called with mu held.
+// The snapshot shares the immutable tree and layers of st.
+func (c *Configuration) record(st *state) {
+	if len(st.history) > 0 {
+		c.version++
+	}
+	history := make([]*Snapshot, 0, len(st.history)+1)
+	history = append(history, st.history...)
+	st.history = c.trimHistory(append(history, &Snapshot{
+		Version:  c.version,
+		Time:     time.Now(),
+		data:     st.tree,
+		flat:     st.keys,
+		layers:   st.layers,
+		keyDelim: st.keyDelim,
+	}))
+}
+
+// trimHistory must be called with mu held.
+func (c *Configuration) trimHistory(history []*Snapshot) []*Snapshot {
+	if n := len(history) - c.historySize; n > 0 {
+		return history[n:]
+	}
+	return history
+}
+
+func cloneLayers(layers []*layer) []*layer {
+	cloned := make([]*layer, 0, len(layers))
+	for _, l := range layers {
+		cloned = append(cloned, &layer{
+			name:     l.name,
+			priority: l.priority,
+			seq:      l.seq,
+			data:     xmap.CloneStringMap(l.data),
+			strings:  l.strings,
+			fold:     l.fold,
+		})
+	}
+	return cloned
+}
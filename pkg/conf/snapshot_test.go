@@ -0,0 +1,105 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Snapshot(t *testing.T) {
+	c := New()
+	initial := c.Snapshot()
+	assert.Equal(t, uint64(0), initial.Version)
+	assert.Empty(t, initial.AllSettings())
+
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"localhost","port":3306},"mode":"dev"}`), JSONUnmarshaller))
+	v1 := c.Snapshot()
+	assert.Equal(t, uint64(1), v1.Version)
+	assert.False(t, v1.Time.Before(initial.Time))
+
+	// no change, no new version
+	require.NoError(t, c.Set("mode", "dev"))
+	assert.Equal(t, v1, c.Snapshot())
+
+	require.NoError(t, c.Set("db.host", "10.0.0.1"))
+	c.SetLayer("remote", PriorityRemote, map[string]interface{}{"db": map[string]interface{}{"port": 3307}, "debug": true})
+	v3 := c.Snapshot()
+	assert.Equal(t, uint64(3), v3.Version)
+
+	// snapshots are immutable
+	assert.Equal(t, "localhost", v1.Get("db.host"))
+	v1.AllSettings()["mode"] = "prod"
+	v1.Get("db").(map[string]interface{})["host"] = "changed"
+	assert.Equal(t, "dev", v1.Get("mode"))
+	assert.Equal(t, "localhost", v1.Traverse(".")["db.host"])
+
+	assert.Equal(t, []Change{
+		{Type: ChangeModified, Key: "db.host", Old: "localhost", New: "10.0.0.1"},
+		{Type: ChangeModified, Key: "db.port", Old: float64(3306), New: 3307},
+		{Type: ChangeAdded, Key: "debug", New: true},
+	}, Diff(v1, v3))
+	assert.Len(t, Diff(nil, v1), 3)
+	assert.Empty(t, Diff(v3, v3))
+
+	versions := make([]uint64, 0)
+	for _, s := range c.Snapshots() {
+		versions = append(versions, s.Version)
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 3}, versions)
+}
+
+func TestConfiguration_Rollback(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"localhost"}}`), JSONUnmarshaller))
+	good := c.Snapshot().Version
+	c.SetLayer("remote", PriorityRemote, map[string]interface{}{"db": map[string]interface{}{"host": "bad"}})
+	assert.Equal(t, "bad", c.GetString("db.host"))
+
+	var changes []Change
+	cancel := c.Watch("", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancel()
+
+	require.NoError(t, c.Rollback(good))
+	assert.Equal(t, "localhost", c.GetString("db.host"))
+	assert.Equal(t, []Change{{Type: ChangeModified, Key: "db.host", Old: "bad", New: "localhost"}}, changes)
+	assert.Equal(t, []string{LayerContent}, c.Layers())
+	assert.Equal(t, good+2, c.Snapshot().Version)
+
+	// the restored layers are not shared with the snapshot
+	require.NoError(t, c.Set("db.host", "10.0.0.1"))
+	require.NoError(t, c.Rollback(good))
+	assert.Equal(t, "localhost", c.GetString("db.host"))
+
+	assert.True(t, errors.Is(c.Rollback(100), ErrSnapshotNotFound))
+}
+
+func TestConfiguration_SetHistorySize(t *testing.T) {
+	c := New()
+	c.SetHistorySize(2)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.Set("count", i))
+	}
+	snapshots := c.Snapshots()
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, uint64(4), snapshots[0].Version)
+	assert.Equal(t, uint64(5), snapshots[1].Version)
+	assert.Error(t, c.Rollback(1))
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"strings"
+)
+
+// state is an immutable view of the configuration. Writers build a new state
+// under mu and publish it atomically, readers load the current state without
+// locking and never observe a half-applied change.
+type state struct {
+	// tree 合并后的配置树
+	tree map[string]interface{}
+	// keys 扁平化的原始值, 以keyDelim连接
+	keys map[string]interface{}
+	// flat 扁平化的解析后的值, 用于计算变更, 加密的值保留密文
+	flat map[string]interface{}
+	// layers 配置层的副本, 按优先级从低到高排列
+	layers []*layer
+	// history 最近的配置快照, 最后一个为当前版本
+	history []*Snapshot
+
+	keyDelim        string
+	caseInsensitive bool
+	decryptor       Decryptor
+}
+
+// load returns the current state.
+func (c *Configuration) load() *state {
+	return c.state.Load().(*state)
+}
+
+// rebuild publishes a new state built from the layers and queues the changes, must be called with mu held.
+func (c *Configuration) rebuild() {
+	prev := c.load()
+	next := &state{
+		tree:            c.merge(),
+		layers:          cloneLayers(c.layers),
+		history:         prev.history,
+		keyDelim:        c.keyDelim,
+		caseInsensitive: c.caseInsensitive,
+		decryptor:       c.decryptor,
+	}
+	next.keys = next.traverse(next.keyDelim)
+	// 按解析后的值比较, 被引用的key变化时引用方也会收到变更, 加密的值不解密
+	next.flat = next.resolveFlat(next.traverse(next.keyDelim), next.keyDelim, false)
+
+	changes := diff(prev.flat, next.flat)
+	if len(changes) > 0 {
+		c.record(next)
+	}
+	c.state.Store(next)
+	c.enqueue(changes)
+}
+
+// find returns the raw value of key.
+func (st *state) find(key string) interface{} {
+	if val, ok := st.keys[key]; ok {
+		return val
+	}
+	val, _ := st.lookupRaw(key)
+	return val
+}
+
+// lookupRaw returns the unresolved value of key in the merged tree.
+func (st *state) lookupRaw(key string) (interface{}, bool) {
+	if st.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	return searchPath(st.tree, splitKey(key, st.keyDelim))
+}
+
+func (st *state) traverse(sep string) map[string]interface{} {
+	data := make(map[string]interface{})
+	lookup("", st.tree, data, sep)
+	return data
+}
+
+// source returns the name of the layer providing the value of key, values dropped
+// while merging, e.g. slice elements beyond the end, are provided by none.
+func (st *state) source(key string) string {
+	if l := st.sourceLayer(key); l != nil {
+		return l.name
+	}
+	return ""
+}
+
+func (st *state) sourceLayer(key string) *layer {
+	paths := strings.Split(key, st.keyDelim)
+	if _, ok := searchPath(st.tree, paths); !ok {
+		return nil
+	}
+	for i := len(st.layers) - 1; i >= 0; i-- {
+		if _, ok := searchPathFold(st.layers[i].data, paths, st.layers[i].fold); ok {
+			return st.layers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run with -race
+func TestConfiguration_ConcurrentReload(t *testing.T) {
+	c := New()
+	c.SetLayer("remote", PriorityRemote, map[string]interface{}{"app": map[string]interface{}{"a": 0, "b": 0}})
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// a reload is never observed half-applied
+				var app struct{ A, B int }
+				if assert.NoError(t, c.UnmarshalKey("app", &app)) {
+					assert.Equal(t, app.A, app.B)
+				}
+				_ = c.GetInt("app.a")
+				_ = c.GetStringMap("app")
+				_ = c.Traverse(".")
+				_ = c.Source("app.a")
+				_ = c.Layers()
+				_ = c.Snapshot()
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		c.SetLayer("remote", PriorityRemote, map[string]interface{}{"app": map[string]interface{}{"a": i, "b": i}})
+		require.NoError(t, c.Set(fmt.Sprintf("runtime.key%d", i%10), i))
+	}
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, 200, c.GetInt("app.a"))
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"strings"
+)
+
+// Sub returns a live view of the sub tree under key, it shares the data of c and sees later reloads.
+// Keys of Get, Set, Watch, UnmarshalKey... are relative to key, content loaded through
+// the view is placed under key. Layers, snapshots, env and flags are shared with c.
+func (c *Configuration) Sub(key string) *Configuration {
+	return &Configuration{store: c.store, prefix: c.key(key)}
+}
+
+// key returns the absolute key of key relative to the view,
+// lowercased in case insensitive mode.
+func (c *Configuration) key(key string) string {
+	key = normalizeKey(key, c.load().keyDelim)
+	if c.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	if c.prefix == "" {
+		return key
+	}
+	if key == "" {
+		return c.prefix
+	}
+	return c.prefix + c.load().keyDelim + key
+}
+
+// relative returns key relative to the view, key must lie under the prefix.
+func (c *Configuration) relative(key string) string {
+	if c.prefix == "" {
+		return key
+	}
+	if key == c.prefix {
+		return ""
+	}
+	return strings.TrimPrefix(key, c.prefix+c.load().keyDelim)
+}
+
+// nest places data under the prefix of the view.
+func (c *Configuration) nest(data map[string]interface{}) map[string]interface{} {
+	if c.prefix == "" {
+		return data
+	}
+	paths := strings.Split(c.prefix, c.load().keyDelim)
+	for i := len(paths) - 1; i >= 0; i-- {
+		data = map[string]interface{}{paths[i]: data}
+	}
+	return data
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguration_Sub(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"localhost","port":3306,"pool":{"size":10}},"app":{"mode":"dev"}}`), JSONUnmarshaller))
+
+	db := c.Sub("db")
+	assert.Equal(t, "localhost", db.GetString("host"))
+	assert.Equal(t, 3306, db.GetInt("port"))
+	assert.Equal(t, 10, db.Sub("pool").GetInt("size"))
+	assert.Equal(t, map[string]interface{}{"host": "localhost", "port": float64(3306), "pool.size": float64(10)}, db.Traverse("."))
+	assert.Equal(t, LayerContent, db.Source("host"))
+
+	var cfg struct {
+		Host string
+		Port int
+	}
+	require.NoError(t, db.UnmarshalKey("", &cfg))
+	assert.Equal(t, "localhost", cfg.Host)
+
+	// reloads of the parent are visible
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"10.0.0.1"}}`), JSONUnmarshaller))
+	assert.Equal(t, "10.0.0.1", db.GetString("host"))
+
+	// Set writes through to the parent under the prefix
+	require.NoError(t, db.Set("port", 3307))
+	assert.Equal(t, 3307, c.GetInt("db.port"))
+	assert.Equal(t, LayerRuntime, c.Source("db.port"))
+
+	// content loaded through the view is placed under the prefix
+	require.NoError(t, db.Load([]byte(`{"user":"root"}`), JSONUnmarshaller, WithLayer("remote", PriorityRemote)))
+	assert.Equal(t, "root", c.GetString("db.user"))
+	assert.Equal(t, "dev", c.GetString("app.mode"))
+}
+
+func TestConfiguration_SubWatch(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"localhost"},"dbx":{"host":"localhost"}}`), JSONUnmarshaller))
+	db := c.Sub("db")
+
+	var (
+		changes  []Change
+		notified []*Configuration
+	)
+	cancel := db.Watch("", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancel()
+	db.OnChange(func(sub *Configuration) {
+		notified = append(notified, sub)
+	})
+
+	require.NoError(t, c.Set("dbx.host", "10.0.0.2"))
+	require.NoError(t, c.Set("app.mode", "prod"))
+	assert.Empty(t, changes)
+	assert.Empty(t, notified)
+
+	require.NoError(t, c.Set("db.host", "10.0.0.1"))
+	assert.Equal(t, []Change{{Type: ChangeModified, Key: "host", Old: "localhost", New: "10.0.0.1"}}, changes)
+	require.Len(t, notified, 1)
+	assert.Equal(t, "10.0.0.1", notified[0].GetString("host"))
+
+	changes = nil
+	cancelHost := db.Watch("port", func(cs []Change) {
+		changes = append(changes, cs...)
+	})
+	defer cancelHost()
+	require.NoError(t, db.Set("port", 3306))
+	assert.Equal(t, []Change{
+		{Type: ChangeAdded, Key: "port", New: 3306},
+		{Type: ChangeAdded, Key: "port", New: 3306},
+	}, changes)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// 支持的配置格式
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+var (
+	// JSONUnmarshaller ...
+	JSONUnmarshaller = normalized(json.Unmarshal)
+	// YAMLUnmarshaller ...
+	YAMLUnmarshaller = normalized(yaml.Unmarshal)
+	// TOMLUnmarshaller ...
+	TOMLUnmarshaller = normalized(toml.Unmarshal)
+)
+
+// ErrUnknownFormat ...
+var ErrUnknownFormat = errors.New("unknown config format")
+
+var unmarshallers = map[string]Unmarshaller{
+	FormatJSON: JSONUnmarshaller,
+	FormatYAML: YAMLUnmarshaller,
+	"yml":      YAMLUnmarshaller,
+	FormatTOML: TOMLUnmarshaller,
+}
+
+// RegisterUnmarshaller registers unmarshaller for format or file extension(without dot).
+func RegisterUnmarshaller(format string, unmarshaller Unmarshaller) {
+	unmarshallers[strings.ToLower(format)] = unmarshaller
+}
+
+// UnmarshallerFor returns unmarshaller for format or file extension.
+func UnmarshallerFor(format string) (Unmarshaller, error) {
+	unmarshaller, ok := unmarshallers[strings.TrimPrefix(strings.ToLower(format), ".")]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownFormat, format)
+	}
+	return unmarshaller, nil
+}
+
+// DetectUnmarshaller picks unmarshaller from the extension of path,
+// falls back to sniffing content when the extension is unknown.
+func DetectUnmarshaller(path string, content []byte) (Unmarshaller, error) {
+	return UnmarshallerFor(detectFormat(path, content))
+}
+
+func detectFormat(path string, content []byte) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if _, ok := unmarshallers[ext]; ok {
+		return ext
+	}
+	return sniffFormat(content)
+}
+
+// sniffFormat guesses format from the first meaningful line of content.
+func sniffFormat(content []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case strings.HasPrefix(line, "["):
+			// [section] 或 [[array]]
+			return FormatTOML
+		}
+		eq, colon := strings.Index(line, "="), strings.Index(line, ":")
+		if eq > 0 && (colon < 0 || eq < colon) {
+			return FormatTOML
+		}
+		return FormatYAML
+	}
+	return FormatYAML
+}
+
+// normalized wraps unmarshal, the decoded tree always consists of
+// map[string]interface{} and []interface{}.
+func normalized(unmarshal Unmarshaller) Unmarshaller {
+	return func(content []byte, v interface{}) error {
+		data := make(map[string]interface{})
+		if err := unmarshal(content, &data); err != nil {
+			return err
+		}
+		data = normalize(data).(map[string]interface{})
+
+		if dst, ok := v.(*map[string]interface{}); ok {
+			if *dst == nil {
+				*dst = make(map[string]interface{}, len(data))
+			}
+			for key, val := range data {
+				(*dst)[key] = val
+			}
+			return nil
+		}
+		return mapstructure.Decode(data, v)
+	}
+}
+
+func normalize(val interface{}) interface{} {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		for key, item := range vv {
+			vv[key] = normalize(item)
+		}
+		return vv
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for key, item := range vv {
+			m[fmt.Sprintf("%v", key)] = normalize(item)
+		}
+		return m
+	case []map[string]interface{}:
+		s := make([]interface{}, 0, len(vv))
+		for _, item := range vv {
+			s = append(s, normalize(item))
+		}
+		return s
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = normalize(item)
+		}
+		return vv
+	default:
+		return val
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	jsonContent = `{"app":{"mode":"dev","servers":[{"host":"a"}]}}`
+	yamlContent = `
+app:
+  mode: dev
+  servers:
+    - host: a
+`
+	tomlContent = `
+[app]
+mode = "dev"
+[[app.servers]]
+host = "a"
+`
+)
+
+func TestUnmarshallers(t *testing.T) {
+	expect := map[string]interface{}{
+		"app": map[string]interface{}{
+			"mode": "dev",
+			"servers": []interface{}{
+				map[string]interface{}{"host": "a"},
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		content      string
+		unmarshaller Unmarshaller
+	}{
+		{name: "json", content: jsonContent, unmarshaller: JSONUnmarshaller},
+		{name: "yaml", content: yamlContent, unmarshaller: YAMLUnmarshaller},
+		{name: "toml", content: tomlContent, unmarshaller: TOMLUnmarshaller},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make(map[string]interface{})
+			require.NoError(t, tt.unmarshaller([]byte(tt.content), &data))
+			assert.Equal(t, expect, data)
+
+			var val struct {
+				App struct {
+					Mode string
+				}
+			}
+			require.NoError(t, tt.unmarshaller([]byte(tt.content), &val))
+			assert.Equal(t, "dev", val.App.Mode)
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		content string
+		format  string
+	}{
+		{path: "app.json", format: FormatJSON},
+		{path: "app.YML", format: "yml"},
+		{path: "app.toml", format: FormatTOML},
+		{path: "app.conf", content: jsonContent, format: FormatJSON},
+		{path: "app.conf", content: yamlContent, format: FormatYAML},
+		{path: "app.conf", content: tomlContent, format: FormatTOML},
+		{path: "app", content: "# comment\nname = \"a:b\"", format: FormatTOML},
+		{path: "app", content: "url: http://a?b=c", format: FormatYAML},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.format, detectFormat(tt.path, []byte(tt.content)), "%s: %s", tt.path, tt.content)
+	}
+
+	_, err := UnmarshallerFor("ini")
+	assert.Error(t, err)
+}
+
+func TestConfiguration_LoadFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"app.yaml": yamlContent,
+		"app.toml": tomlContent,
+		"app.cfg":  jsonContent,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+		c := New()
+		require.NoError(t, c.LoadFromFile(path), name)
+		assert.Equal(t, "dev", c.GetString("app.mode"), name)
+		assert.Equal(t, "a", c.GetSliceStringMap("app.servers")[0]["host"], name)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError describes a field violating a validate rule.
+type FieldError struct {
+	// Path 字段对应的配置路径, 如 server.port
+	Path string
+	// Rule 违反的校验规则, 如 max=65535
+	Rule    string
+	Message string
+}
+
+// Error ...
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors aggregates all the invalid fields of UnmarshalKey.
+type ValidationErrors []*FieldError
+
+// Error ...
+func (errs ValidationErrors) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "invalid configuration, %d error(s):", len(errs))
+	for _, err := range errs {
+		sb.WriteString("\n    ")
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fieldKey returns the configuration key of field, ok is false if the field is skipped,
+// squash is true for embedded structs squashed into the parent.
+func fieldKey(field reflect.StructField, tagName string) (key string, squash bool, ok bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false, false
+	}
+	tag := field.Tag.Get(tagName)
+	parts := strings.Split(tag, ",")
+	if parts[0] == "-" {
+		return "", false, false
+	}
+	for _, part := range parts[1:] {
+		if part == "squash" {
+			squash = true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], squash, true
+	}
+	return field.Name, squash, true
+}
+
+// lookupKey finds key in data the way mapstructure does, exact match first then case insensitive.
+func lookupKey(data map[string]interface{}, key string) (string, bool) {
+	if _, ok := data[key]; ok {
+		return key, true
+	}
+	for k := range data {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// applyDefaults fills the keys missing from data with the default tags of typ,
+// visiting holds the enclosing structs to stop on recursive types.
+func applyDefaults(typ reflect.Type, data map[string]interface{}, options GetOptions, visiting []reflect.Type) {
+	typ = indirectType(typ)
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+	visiting = append(visiting, typ)
+
+fields:
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key, squash, ok := fieldKey(field, options.TagName)
+		if !ok {
+			continue
+		}
+		if squash {
+			applyDefaults(field.Type, data, options, visiting)
+			continue
+		}
+
+		actual, exists := lookupKey(data, key)
+		fieldType := indirectType(field.Type)
+		if def, ok := field.Tag.Lookup(options.DefaultTagName); ok && !exists {
+			if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+				// 数组的默认值以逗号分隔, 如 default:"a,b"
+				items := splitDefault(def)
+				values := make([]interface{}, len(items))
+				for i, item := range items {
+					values[i] = item
+				}
+				data[key] = values
+				continue
+			}
+			data[key] = def
+			continue
+		}
+
+		if exists && (fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array) {
+			// 数组中的每个元素
+			if items, ok := data[actual].([]interface{}); ok {
+				for _, item := range items {
+					if sub, ok := item.(map[string]interface{}); ok {
+						applyDefaults(fieldType.Elem(), sub, options, visiting)
+					}
+				}
+			}
+			continue
+		}
+		if fieldType.Kind() != reflect.Struct {
+			continue
+		}
+		if !exists {
+			// 嵌套结构体只在存在默认值时才创建, 递归类型不再展开
+			for _, t := range visiting {
+				if t == fieldType {
+					continue fields
+				}
+			}
+			sub := make(map[string]interface{})
+			applyDefaults(field.Type, sub, options, visiting)
+			if len(sub) > 0 {
+				data[key] = sub
+			}
+			continue
+		}
+		if sub, ok := data[actual].(map[string]interface{}); ok {
+			applyDefaults(field.Type, sub, options, visiting)
+		}
+	}
+}
+
+// visit is a pointer or map already validated, it stops the recursion on cyclic values.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// validateStruct checks val against the validate tags, path is the key val decoded from.
+func validateStruct(val reflect.Value, path string, options GetOptions, errs *ValidationErrors, visited map[visit]bool) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		if val.Kind() == reflect.Ptr {
+			v := visit{ptr: val.Pointer(), typ: val.Type()}
+			if visited[v] {
+				return
+			}
+			visited[v] = true
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			validateStruct(val.Index(i), fmt.Sprintf("%s[%d]", path, i), options, errs, visited)
+		}
+		return
+	case reflect.Map:
+		v := visit{ptr: val.Pointer(), typ: val.Type()}
+		if val.IsNil() || visited[v] {
+			return
+		}
+		visited[v] = true
+		for _, k := range val.MapKeys() {
+			validateStruct(val.MapIndex(k), joinPath(path, fmt.Sprint(k.Interface())), options, errs, visited)
+		}
+		return
+	default:
+		return
+	}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key, squash, ok := fieldKey(field, options.TagName)
+		if !ok || field.PkgPath != "" {
+			continue
+		}
+		fieldPath := joinPath(path, key)
+		if squash {
+			fieldPath = path
+		}
+
+		if rules, ok := field.Tag.Lookup(options.ValidateTagName); ok && rules != "" {
+			for _, rule := range strings.Split(rules, ",") {
+				rule = strings.TrimSpace(rule)
+				// omitempty 字段为空时跳过其余规则
+				if rule == "omitempty" {
+					if val.Field(i).IsZero() {
+						break
+					}
+					continue
+				}
+				if err := checkRule(val.Field(i), rule); err != nil {
+					err.Path = fieldPath
+					*errs = append(*errs, err)
+				}
+			}
+		}
+		validateStruct(val.Field(i), fieldPath, options, errs, visited)
+	}
+}
+
+// splitDefault splits the comma separated default of a slice, an empty default is an empty slice.
+func splitDefault(def string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(def, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// checkRule checks a single rule: required, min=n, max=n, len=n or oneof=a b c, other rules are ignored.
+func checkRule(val reflect.Value, rule string) *FieldError {
+	name, param := rule, ""
+	if idx := strings.Index(rule, "="); idx >= 0 {
+		name, param = rule[:idx], rule[idx+1:]
+	}
+
+	fail := func(format string, args ...interface{}) *FieldError {
+		return &FieldError{Rule: rule, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if name != "required" && val.Kind() == reflect.Ptr && val.IsNil() {
+		return nil
+	}
+
+	switch name {
+	case "":
+		return nil
+	case "required":
+		if val.IsZero() {
+			return fail("is required")
+		}
+		return nil
+	case "oneof":
+		actual := fmt.Sprint(reflect.Indirect(val).Interface())
+		for _, option := range strings.Fields(param) {
+			if actual == option {
+				return nil
+			}
+		}
+		return fail("must be one of [%s], got %q", param, actual)
+	case "min", "max", "len":
+		actual, limit, err := measure(reflect.Indirect(val), param)
+		if err != nil {
+			return fail("bad rule %q: %v", rule, err)
+		}
+		switch {
+		case name == "min" && actual < limit:
+			return fail("must be >= %s", param)
+		case name == "max" && actual > limit:
+			return fail("must be <= %s", param)
+		case name == "len" && actual != limit:
+			return fail("length must be %s", param)
+		}
+		return nil
+	default:
+		// 其他校验器的规则, 如email, 交由对应的校验器处理
+		return nil
+	}
+}
+
+// measure returns the number compared by min, max and len:
+// the value of numbers and durations, the length of strings, slices and maps.
+func measure(val reflect.Value, param string) (actual, limit float64, err error) {
+	if val.Type() == durationType {
+		d, err := time.ParseDuration(param)
+		return float64(val.Int()), float64(d), err
+	}
+
+	limit, err = strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), limit, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), limit, nil
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), limit, nil
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(val.Len()), limit, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported kind %s", val.Kind())
+	}
+}
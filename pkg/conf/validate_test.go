@@ -0,0 +1,134 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validateDB struct {
+	DSN     string        `mapstructure:"dsn" validate:"required"`
+	Timeout time.Duration `mapstructure:"timeout" default:"3s" validate:"min=1s,max=1m"`
+}
+
+type validateServer struct {
+	Host    string       `mapstructure:"host" default:"localhost"`
+	Port    int          `mapstructure:"port" default:"8080" validate:"min=1,max=65535"`
+	Mode    string       `mapstructure:"mode" default:"dev" validate:"oneof=dev test prod"`
+	Tags    []string     `mapstructure:"tags" validate:"omitempty,max=2"`
+	DB      validateDB   `mapstructure:"db"`
+	Backups []validateDB `mapstructure:"backups"`
+}
+
+func TestConfiguration_UnmarshalKeyDefaults(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"server":{"port":9090,"db":{"dsn":"root@tcp"}}}`), JSONUnmarshaller))
+
+	var server validateServer
+	require.NoError(t, c.UnmarshalKey("server", &server))
+	assert.Equal(t, validateServer{
+		Host: "localhost",
+		Port: 9090,
+		Mode: "dev",
+		DB:   validateDB{DSN: "root@tcp", Timeout: 3 * time.Second},
+	}, server)
+
+	// defaults never leak into the configuration
+	assert.Nil(t, c.Get("server.host"))
+}
+
+func TestConfiguration_UnmarshalKeyDefaultsMissing(t *testing.T) {
+	type listen struct {
+		Host  string   `mapstructure:"host" default:"localhost"`
+		Hosts []string `mapstructure:"hosts" default:"a, b"`
+		Ports []int    `mapstructure:"ports" default:"80,443"`
+		Empty []string `mapstructure:"empty" default:""`
+	}
+
+	// the whole section is missing
+	c := New()
+	var l listen
+	require.NoError(t, c.UnmarshalKey("server", &l))
+	assert.Equal(t, listen{Host: "localhost", Hosts: []string{"a", "b"}, Ports: []int{80, 443}, Empty: []string{}}, l)
+
+	// sections missing without defaults are still invalid
+	var db validateDB
+	err := c.UnmarshalKey("db", &db, DefaultTagName(""))
+	assert.True(t, errors.Is(err, ErrInvalidKey), "%v", err)
+
+	// slice defaults are used only if the key is missing
+	require.NoError(t, c.Load([]byte(`{"server":{"hosts":["c"]}}`), JSONUnmarshaller))
+	l = listen{}
+	require.NoError(t, c.UnmarshalKey("server", &l))
+	assert.Equal(t, []string{"c"}, l.Hosts)
+	assert.Equal(t, []int{80, 443}, l.Ports)
+}
+
+func TestConfiguration_UnmarshalKeyValidate(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"server":{
+		"port":70000,
+		"mode":"staging",
+		"tags":["a","b","c"],
+		"db":{"timeout":"2m"},
+		"backups":[{"dsn":"a"},{"dsn":""}]
+	}}`), JSONUnmarshaller))
+
+	var server validateServer
+	err := c.UnmarshalKey("server", &server)
+	require.Error(t, err)
+
+	errs, ok := err.(ValidationErrors)
+	require.True(t, ok)
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path+" "+e.Rule)
+	}
+	assert.Equal(t, []string{
+		"server.port max=65535",
+		"server.mode oneof=dev test prod",
+		"server.tags max=2",
+		"server.db.dsn required",
+		"server.db.timeout max=1m",
+		"server.backups[1].dsn required",
+	}, paths)
+	assert.Contains(t, err.Error(), "server.port: must be <= 65535")
+
+	// tags can be disabled
+	require.NoError(t, c.UnmarshalKey("server", &server, ValidateTagName("")))
+}
+
+type validateNode struct {
+	Name  string `validate:"required"`
+	Email string `validate:"omitempty,email"`
+	Self  *validateNode
+}
+
+func TestConfiguration_UnmarshalKeyValidateCycle(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"node":{"name":"a","email":"a@b.c"}}`), JSONUnmarshaller))
+
+	// 未知规则交由其他校验器处理
+	var node validateNode
+	node.Self = &node
+	require.NoError(t, c.UnmarshalKey("node", &node))
+	assert.Equal(t, "a@b.c", node.Email)
+	assert.True(t, node.Self == &node)
+}
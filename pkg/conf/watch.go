@@ -0,0 +1,217 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeType ...
+type ChangeType int
+
+// 变更类型
+const (
+	ChangeAdded ChangeType = iota + 1
+	ChangeRemoved
+	ChangeModified
+)
+
+// String ...
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change describes the modification of a key, Old is nil for an added key
+// and New is nil for a removed key. Encrypted values are never decrypted in changes.
+type Change struct {
+	Type ChangeType
+	Key  string
+	Old  interface{}
+	New  interface{}
+}
+
+// ChangeEvent carries all the changes made by a single modification,
+// e.g. Load, Apply, Set or a data source reload.
+type ChangeEvent struct {
+	Changes []Change
+}
+
+// Added returns the changes of added keys.
+func (e *ChangeEvent) Added() []Change {
+	return e.filter(ChangeAdded)
+}
+
+// Removed returns the changes of removed keys.
+func (e *ChangeEvent) Removed() []Change {
+	return e.filter(ChangeRemoved)
+}
+
+// Modified returns the changes of modified keys.
+func (e *ChangeEvent) Modified() []Change {
+	return e.filter(ChangeModified)
+}
+
+func (e *ChangeEvent) filter(typ ChangeType) []Change {
+	var changes []Change
+	for _, change := range e.Changes {
+		if change.Type == typ {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+type watcher struct {
+	prefix  string
+	fn      func([]Change)
+	removed bool
+}
+
+// Watch registers fn to be called with the changes of keys under prefix,
+// "db" matches "db" and "db.host" but not "dbx.host", an empty prefix matches all keys.
+// Changes are delivered in order, on the goroutine that made the modification
+// or on the one already delivering. The returned function unsubscribes fn.
+func (c *Configuration) Watch(prefix string, fn func(changes []Change)) (cancel func()) {
+	if c.prefix != "" {
+		// 子视图收到的变更key相对于子视图
+		watch := fn
+		fn = func(changes []Change) {
+			relative := make([]Change, len(changes))
+			for i, change := range changes {
+				change.Key = c.relative(change.Key)
+				relative[i] = change
+			}
+			watch(relative)
+		}
+	}
+
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+
+	w := &watcher{prefix: c.key(prefix), fn: fn}
+	c.watchers = append(c.watchers, w)
+
+	return func() {
+		c.dispatchMu.Lock()
+		defer c.dispatchMu.Unlock()
+
+		for i, item := range c.watchers {
+			if item == w {
+				c.watchers = append(c.watchers[:i], c.watchers[i+1:]...)
+				break
+			}
+		}
+		w.removed = true
+	}
+}
+
+// OnChangeEvent registers fn to be called with every ChangeEvent,
+// it is delivered in the same way as Watch.
+func (c *Configuration) OnChangeEvent(fn func(event *ChangeEvent)) (cancel func()) {
+	return c.Watch("", func(changes []Change) {
+		fn(&ChangeEvent{Changes: changes})
+	})
+}
+
+// diff returns the changes between two flattened views, sorted by key.
+func diff(prev, next map[string]interface{}) []Change {
+	var changes []Change
+	for key, val := range next {
+		orig, ok := prev[key]
+		if !ok {
+			changes = append(changes, Change{Type: ChangeAdded, Key: key, New: val})
+		} else if !reflect.DeepEqual(orig, val) {
+			changes = append(changes, Change{Type: ChangeModified, Key: key, Old: orig, New: val})
+		}
+	}
+	for key, orig := range prev {
+		if _, ok := next[key]; !ok {
+			changes = append(changes, Change{Type: ChangeRemoved, Key: key, Old: orig})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// matchKey reports whether key is prefix or lies under it, segment by segment.
+func matchKey(key, prefix, delim string) bool {
+	if prefix == "" || key == prefix {
+		return true
+	}
+	return strings.HasPrefix(key, prefix+delim)
+}
+
+// enqueue queues changes for delivery, must be called with mu held to keep the order.
+func (c *Configuration) enqueue(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	c.dispatchMu.Lock()
+	c.pending = append(c.pending, changes)
+	c.dispatchMu.Unlock()
+}
+
+// dispatch delivers queued changes, must be called without mu held.
+// Only one goroutine delivers at a time, changes queued by handlers
+// are delivered after the current ones by the same goroutine.
+func (c *Configuration) dispatch() {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+
+	if c.dispatching {
+		return
+	}
+	c.dispatching = true
+	defer func() { c.dispatching = false }()
+
+	for len(c.pending) > 0 {
+		changes := c.pending[0]
+		c.pending = c.pending[1:]
+		watchers := append([]*watcher(nil), c.watchers...)
+		delim := c.load().keyDelim
+
+		for _, w := range watchers {
+			var matched []Change
+			for _, change := range changes {
+				if matchKey(change.Key, w.prefix, delim) {
+					matched = append(matched, change)
+				}
+			}
+			if len(matched) > 0 && !w.removed {
+				c.deliver(w.fn, matched)
+			}
+		}
+	}
+}
+
+// deliver calls fn without dispatchMu held.
+func (c *Configuration) deliver(fn func([]Change), changes []Change) {
+	c.dispatchMu.Unlock()
+	defer c.dispatchMu.Lock()
+	fn(changes)
+}
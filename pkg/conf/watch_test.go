@@ -0,0 +1,146 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchKey(t *testing.T) {
+	assert.True(t, matchKey("db", "db", "."))
+	assert.True(t, matchKey("db.host", "db", "."))
+	assert.True(t, matchKey("db.host", "", "."))
+	assert.False(t, matchKey("dbx.host", "db", "."))
+	assert.False(t, matchKey("db", "db.host", "."))
+}
+
+func TestConfiguration_Watch(t *testing.T) {
+	c := New()
+	require.NoError(t, c.Load([]byte(`{"db":{"host":"a","port":1},"dbx":{"host":"a"}}`), JSONUnmarshaller))
+
+	var got [][]Change
+	cancel := c.Watch("db", func(changes []Change) {
+		got = append(got, changes)
+	})
+
+	require.NoError(t, c.Set("dbx.host", "b"))
+	assert.Empty(t, got)
+
+	c.SetLayer(LayerContent, PriorityFile, map[string]interface{}{
+		"db":  map[string]interface{}{"host": "b", "user": "root"},
+		"dbx": map[string]interface{}{"host": "a"},
+	})
+	require.Len(t, got, 1)
+	assert.Equal(t, []Change{
+		{Type: ChangeModified, Key: "db.host", Old: "a", New: "b"},
+		{Type: ChangeRemoved, Key: "db.port", Old: float64(1)},
+		{Type: ChangeAdded, Key: "db.user", New: "root"},
+	}, got[0])
+
+	// unchanged values are not delivered
+	require.NoError(t, c.Set("db.host", "b"))
+	assert.Len(t, got, 1)
+
+	cancel()
+	require.NoError(t, c.Set("db.host", "c"))
+	assert.Len(t, got, 1)
+}
+
+func TestConfiguration_WatchOrder(t *testing.T) {
+	c := New()
+
+	var got []interface{}
+	c.Watch("a", func(changes []Change) {
+		got = append(got, changes[0].New)
+		// changes made by a handler are delivered after the current ones
+		if changes[0].New == 1 {
+			require.NoError(t, c.Set("a", 2))
+			got = append(got, "set")
+		}
+	})
+	c.Watch("a", func(changes []Change) {
+		got = append(got, changes[0].New)
+	})
+
+	require.NoError(t, c.Set("a", 1))
+	assert.Equal(t, []interface{}{1, "set", 1, 2, 2}, got)
+}
+
+func TestConfiguration_WatchConcurrent(t *testing.T) {
+	c := New()
+	var (
+		mu   sync.Mutex
+		last = map[string]interface{}{}
+	)
+	c.Watch("", func(changes []Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, change := range changes {
+			last[change.Key] = change.New
+		}
+	})
+
+	goroutines := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = c.Set("key", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	_ = c.Set("key", "done")
+
+	mu.Lock()
+	assert.Equal(t, "done", last["key"])
+	mu.Unlock()
+	assert.Equal(t, goroutines, runtime.NumGoroutine())
+}
+
+func TestConfiguration_OnChangeEvent(t *testing.T) {
+	c := New()
+	var (
+		events []*ChangeEvent
+		calls  int
+	)
+	c.OnChangeEvent(func(event *ChangeEvent) {
+		events = append(events, event)
+	})
+	c.OnChange(func(*Configuration) {
+		calls++
+	})
+
+	require.NoError(t, c.Load([]byte(`{"a":1,"b":2}`), JSONUnmarshaller))
+	require.NoError(t, c.apply(nil))
+	require.NoError(t, c.apply(map[string]interface{}{"a": 3}))
+	require.NoError(t, c.Set("c", 4))
+	c.RemoveLayer(LayerContent)
+
+	require.Len(t, events, 4)
+	assert.Equal(t, 4, calls)
+	assert.Len(t, events[0].Added(), 2)
+	assert.Equal(t, []Change{{Type: ChangeModified, Key: "a", Old: float64(1), New: 3}}, events[1].Modified())
+	assert.Equal(t, []Change{{Type: ChangeAdded, Key: "c", New: 4}}, events[2].Added())
+	assert.Len(t, events[3].Removed(), 2)
+	assert.Empty(t, events[3].Added())
+}
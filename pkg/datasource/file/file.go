@@ -0,0 +1,189 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// defaultDebounce means the default quiet period before a change is signaled
+	defaultDebounce = 100 * time.Millisecond
+)
+
+// DataSource file provider, implements conf.DataSource.
+type DataSource struct {
+	path     string
+	dir      string
+	realPath string
+	debounce time.Duration
+
+	watcher   *fsnotify.Watcher
+	changed   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Option ...
+type Option func(ds *DataSource)
+
+// WithDebounce 设置文件变更事件的合并间隔
+func WithDebounce(d time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.debounce = d
+	}
+}
+
+// NewDataSource returns new file DataSource.
+// if watch is true, writes, touches and rename-over replacements of path
+// (including symlink swaps used by k8s ConfigMap) are signaled through IsConfigChanged.
+func NewDataSource(path string, watch bool, opts ...Option) (*DataSource, error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DataSource{
+		path:     absolutePath,
+		dir:      filepath.Dir(absolutePath),
+		debounce: defaultDebounce,
+		changed:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	ds.realPath, _ = filepath.EvalSymlinks(ds.path)
+
+	if watch {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		// 监听所在目录而不是文件本身, 文件被替换后依然可以收到事件
+		if err := watcher.Add(ds.dir); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+		ds.watcher = watcher
+		ds.wg.Add(1)
+		go ds.watch()
+	}
+
+	return ds, nil
+}
+
+// ReadConfig ...
+func (ds *DataSource) ReadConfig() ([]byte, error) {
+	return ioutil.ReadFile(ds.path)
+}
+
+// String returns "file:<path>", it names the configuration layer the file is loaded into.
+func (ds *DataSource) String() string {
+	return "file:" + ds.path
+}
+
+// IsConfigChanged returns a channel for notification when the config changed.
+// the channel is closed after Close is called.
+func (ds *DataSource) IsConfigChanged() <-chan struct{} {
+	return ds.changed
+}
+
+// Close stops watching and closes the change channel.
+func (ds *DataSource) Close() error {
+	var err error
+	ds.closeOnce.Do(func() {
+		close(ds.done)
+		if ds.watcher != nil {
+			err = ds.watcher.Close()
+		}
+		ds.wg.Wait()
+		close(ds.changed)
+	})
+	return err
+}
+
+func (ds *DataSource) watch() {
+	defer ds.wg.Done()
+
+	var (
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-ds.watcher.Events:
+			if !ok {
+				return
+			}
+			if !ds.isTargetEvent(event) {
+				continue
+			}
+			// 合并短时间内的多次变更, 只通知一次
+			if timer == nil {
+				timer = time.NewTimer(ds.debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(ds.debounce)
+			}
+			timeout = timer.C
+		case <-timeout:
+			timeout = nil
+			select {
+			case ds.changed <- struct{}{}:
+			default:
+			}
+		case _, ok := <-ds.watcher.Errors:
+			if !ok {
+				return
+			}
+		case <-ds.done:
+			return
+		}
+	}
+}
+
+// isTargetEvent reports whether the event affects the watched file.
+func (ds *DataSource) isTargetEvent(event fsnotify.Event) bool {
+	// symlink target changed, e.g. k8s ConfigMap ..data swap
+	realPath, _ := filepath.EvalSymlinks(ds.path)
+	if realPath != "" && realPath != ds.realPath {
+		ds.realPath = realPath
+		return true
+	}
+
+	if filepath.Clean(event.Name) != ds.path {
+		return false
+	}
+	const ops = fsnotify.Write | fsnotify.Create | fsnotify.Chmod
+	return event.Op&ops != 0
+}
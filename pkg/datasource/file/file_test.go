@@ -0,0 +1,160 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mesment/sparrow/pkg/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDebounce = 20 * time.Millisecond
+
+func newTestDataSource(t *testing.T, content string) (*DataSource, string) {
+	dir, err := ioutil.TempDir("", "file-datasource")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "app.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	ds, err := NewDataSource(path, true, WithDebounce(testDebounce))
+	require.NoError(t, err)
+	t.Cleanup(func() { ds.Close() })
+	return ds, path
+}
+
+func waitChanged(t *testing.T, ds *DataSource) {
+	select {
+	case <-ds.IsConfigChanged():
+	case <-time.After(2 * time.Second):
+		t.Fatal("change not signaled")
+	}
+}
+
+func assertNotChanged(t *testing.T, ds *DataSource) {
+	select {
+	case <-ds.IsConfigChanged():
+		t.Fatal("unexpected change signaled")
+	case <-time.After(5 * testDebounce):
+	}
+}
+
+func TestDataSource_ReadConfig(t *testing.T) {
+	ds, _ := newTestDataSource(t, `{"app":{"mode":"dev"}}`)
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"app":{"mode":"dev"}}`, string(content))
+}
+
+func TestDataSource_Watch(t *testing.T) {
+	t.Run("rewrite", func(t *testing.T) {
+		ds, path := newTestDataSource(t, `{}`)
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{"a":1}`), 0644))
+		waitChanged(t, ds)
+	})
+
+	t.Run("rename over", func(t *testing.T) {
+		ds, path := newTestDataSource(t, `{}`)
+		tmp := path + ".tmp"
+		require.NoError(t, ioutil.WriteFile(tmp, []byte(`{"a":1}`), 0644))
+		require.NoError(t, os.Rename(tmp, path))
+		waitChanged(t, ds)
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		ds, path := newTestDataSource(t, `{}`)
+		now := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(path, now, now))
+		waitChanged(t, ds)
+	})
+
+	t.Run("symlink swap", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "file-datasource")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		// layout used by k8s ConfigMap volumes
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "v1"), 0755))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "v2"), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v1", "app.json"), []byte(`{}`), 0644))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v2", "app.json"), []byte(`{"a":1}`), 0644))
+		require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+		require.NoError(t, os.Symlink(filepath.Join("..data", "app.json"), filepath.Join(dir, "app.json")))
+
+		ds, err := NewDataSource(filepath.Join(dir, "app.json"), true, WithDebounce(testDebounce))
+		require.NoError(t, err)
+		defer ds.Close()
+
+		require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+		waitChanged(t, ds)
+
+		content, err := ds.ReadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, `{"a":1}`, string(content))
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		ds, path := newTestDataSource(t, `{}`)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, ioutil.WriteFile(path, []byte(`{"a":1}`), 0644))
+		}
+		waitChanged(t, ds)
+		assertNotChanged(t, ds)
+	})
+
+	t.Run("other file", func(t *testing.T) {
+		ds, path := newTestDataSource(t, `{}`)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(path), "other.json"), []byte(`{}`), 0644))
+		assertNotChanged(t, ds)
+	})
+}
+
+func TestDataSource_Close(t *testing.T) {
+	ds, _ := newTestDataSource(t, `{}`)
+	require.NoError(t, ds.Close())
+	_, ok := <-ds.IsConfigChanged()
+	assert.False(t, ok)
+	assert.NoError(t, ds.Close())
+}
+
+func TestDataSource_LoadFromDataSource(t *testing.T) {
+	ds, path := newTestDataSource(t, `{"app":{"mode":"dev"}}`)
+
+	c := conf.New()
+	require.NoError(t, c.LoadFromDataSource(ds, json.Unmarshal))
+	assert.Equal(t, "dev", c.GetString("app.mode"))
+
+	reloaded := make(chan struct{}, 1)
+	c.OnChange(func(*conf.Configuration) {
+		reloaded <- struct{}{}
+	})
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"app":{"mode":"prod"}}`), 0644))
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("configuration not reloaded")
+	}
+	assert.Equal(t, "prod", c.GetString("app.mode"))
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSeparator = "/"
+	// defaultRetry means the delay before a broken watch is established again
+	defaultRetry = time.Second
+)
+
+// KeyValue ...
+type KeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// Client is the subset of a KV store (etcd, Consul...) used by DataSource.
+type Client interface {
+	// List returns all the pairs whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]KeyValue, error)
+	// Watch returns a channel signaled when keys under prefix change,
+	// the channel is closed when ctx is done or the watch is broken.
+	Watch(ctx context.Context, prefix string) (<-chan struct{}, error)
+}
+
+// DataSource kv provider, implements conf.DataSource.
+// The keys under prefix are mapped to a nested tree by separator and served as JSON:
+// with prefix "/config/app/", key "/config/app/db/host" becomes {"db":{"host":"..."}}.
+type DataSource struct {
+	client    Client
+	prefix    string
+	separator string
+	retry     time.Duration
+
+	changed   chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Option ...
+type Option func(ds *DataSource)
+
+// WithSeparator 设置key的层级分隔符, 默认为 /
+func WithSeparator(sep string) Option {
+	return func(ds *DataSource) {
+		ds.separator = sep
+	}
+}
+
+// WithRetry 设置watch中断后重新建立的间隔
+func WithRetry(d time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.retry = d
+	}
+}
+
+// NewDataSource returns new kv DataSource.
+// if watch is true, changes under prefix are signaled through IsConfigChanged.
+func NewDataSource(client Client, prefix string, watch bool, opts ...Option) (*DataSource, error) {
+	ds := &DataSource{
+		client:    client,
+		prefix:    prefix,
+		separator: defaultSeparator,
+		retry:     defaultRetry,
+		changed:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	ds.ctx, ds.cancel = context.WithCancel(context.Background())
+
+	if watch {
+		events, err := ds.client.Watch(ds.ctx, ds.prefix)
+		if err != nil {
+			ds.cancel()
+			return nil, err
+		}
+		ds.wg.Add(1)
+		go ds.watch(events)
+	}
+	return ds, nil
+}
+
+// ReadConfig returns the keys under prefix as a JSON document.
+func (ds *DataSource) ReadConfig() ([]byte, error) {
+	kvs, err := ds.client.List(ds.ctx, ds.prefix)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ds.tree(kvs))
+}
+
+// String returns "kv:<prefix>", it names the configuration layer the keys are loaded into.
+func (ds *DataSource) String() string {
+	return "kv:" + ds.prefix
+}
+
+// IsConfigChanged returns a channel for notification when the config changed.
+// the channel is closed after Close is called.
+func (ds *DataSource) IsConfigChanged() <-chan struct{} {
+	return ds.changed
+}
+
+// Close stops watching and closes the change channel.
+func (ds *DataSource) Close() error {
+	ds.closeOnce.Do(func() {
+		ds.cancel()
+		ds.wg.Wait()
+		close(ds.changed)
+	})
+	return nil
+}
+
+func (ds *DataSource) watch(events <-chan struct{}) {
+	defer ds.wg.Done()
+
+	for {
+		for range events {
+			select {
+			case ds.changed <- struct{}{}:
+			default:
+			}
+		}
+
+		// watch中断, 等待后重新建立
+		for {
+			select {
+			case <-ds.ctx.Done():
+				return
+			case <-time.After(ds.retry):
+			}
+			var err error
+			if events, err = ds.client.Watch(ds.ctx, ds.prefix); err == nil {
+				break
+			}
+		}
+		// 中断期间可能错过了变更
+		select {
+		case ds.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// tree maps the pairs to a nested map, a key that is both a value and
+// a directory is treated as a directory.
+func (ds *DataSource) tree(kvs []KeyValue) map[string]interface{} {
+	root := make(map[string]interface{})
+	for _, kv := range kvs {
+		var paths []string
+		for _, path := range strings.Split(strings.TrimPrefix(kv.Key, ds.prefix), ds.separator) {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		node := root
+		for _, path := range paths[:len(paths)-1] {
+			sub, ok := node[path].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				node[path] = sub
+			}
+			node = sub
+		}
+		last := paths[len(paths)-1]
+		if _, ok := node[last].(map[string]interface{}); !ok {
+			node[last] = string(kv.Value)
+		}
+	}
+	return root
+}
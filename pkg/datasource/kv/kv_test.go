@@ -0,0 +1,114 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mesment/sparrow/pkg/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitChanged(t *testing.T, ds *DataSource) {
+	select {
+	case <-ds.IsConfigChanged():
+	case <-time.After(2 * time.Second):
+		t.Fatal("change not signaled")
+	}
+}
+
+func TestDataSource_ReadConfig(t *testing.T) {
+	client := NewMemoryClient()
+	client.Put("/config/app/db/host", "localhost")
+	client.Put("/config/app/db/port", "3306")
+	client.Put("/config/app/mode", "dev")
+	client.Put("/config/app/server", "ignored")
+	client.Put("/config/app/server/port", "8080")
+	client.Put("/config/other/mode", "prod")
+
+	ds, err := NewDataSource(client, "/config/app/", false)
+	require.NoError(t, err)
+	defer ds.Close()
+	assert.Equal(t, "kv:/config/app/", ds.String())
+
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"db":{"host":"localhost","port":"3306"},"mode":"dev","server":{"port":"8080"}}`, string(content))
+}
+
+func TestDataSource_Separator(t *testing.T) {
+	client := NewMemoryClient()
+	client.Put("app.db.host", "localhost")
+
+	ds, err := NewDataSource(client, "app.", false, WithSeparator("."))
+	require.NoError(t, err)
+	defer ds.Close()
+
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"db":{"host":"localhost"}}`, string(content))
+}
+
+func TestDataSource_Watch(t *testing.T) {
+	client := NewMemoryClient()
+	ds, err := NewDataSource(client, "/config/app/", true, WithRetry(10*time.Millisecond))
+	require.NoError(t, err)
+
+	client.Put("/config/other/mode", "prod")
+	client.Put("/config/app/mode", "dev")
+	waitChanged(t, ds)
+
+	// broken watches are established again
+	client.CloseWatches()
+	waitChanged(t, ds)
+	client.Delete("/config/app/mode")
+	waitChanged(t, ds)
+
+	require.NoError(t, ds.Close())
+	_, ok := <-ds.IsConfigChanged()
+	assert.False(t, ok)
+}
+
+func TestDataSource_LoadFromDataSource(t *testing.T) {
+	client := NewMemoryClient()
+	client.Put("/config/app/mode", "dev")
+	client.Put("/config/app/port", "8080")
+
+	ds, err := NewDataSource(client, "/config/app/", true)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	c := conf.New()
+	require.NoError(t, c.LoadFromDataSource(ds, json.Unmarshal))
+	assert.Equal(t, "dev", c.GetString("mode"))
+	assert.Equal(t, 8080, c.GetInt("port"))
+	assert.Equal(t, "kv:/config/app/", c.Source("mode"))
+
+	reloaded := make(chan struct{}, 1)
+	c.OnChange(func(*conf.Configuration) {
+		reloaded <- struct{}{}
+	})
+
+	client.Put("/config/app/mode", "prod")
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("configuration not reloaded")
+	}
+	assert.Equal(t, "prod", c.GetString("mode"))
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryClient is an in-memory Client, for tests and local development.
+type MemoryClient struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	watchers map[*memoryWatcher]struct{}
+}
+
+type memoryWatcher struct {
+	prefix string
+	events chan struct{}
+}
+
+// NewMemoryClient ...
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		data:     make(map[string][]byte),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+}
+
+// Put sets the value of key.
+func (m *MemoryClient) Put(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = []byte(value)
+	m.notify(key)
+}
+
+// Delete removes key.
+func (m *MemoryClient) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		delete(m.data, key)
+		m.notify(key)
+	}
+}
+
+// List ...
+func (m *MemoryClient) List(ctx context.Context, prefix string) ([]KeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kvs []KeyValue
+	for key, value := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			kvs = append(kvs, KeyValue{Key: key, Value: append([]byte(nil), value...)})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs, nil
+}
+
+// Watch ...
+func (m *MemoryClient) Watch(ctx context.Context, prefix string) (<-chan struct{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	w := &memoryWatcher{prefix: prefix, events: make(chan struct{}, 1)}
+	m.mu.Lock()
+	m.watchers[w] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.watchers[w]; ok {
+			delete(m.watchers, w)
+			close(w.events)
+		}
+	}()
+	return w.events, nil
+}
+
+// CloseWatches breaks all the watches, as a KV store connection loss does.
+func (m *MemoryClient) CloseWatches() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for w := range m.watchers {
+		delete(m.watchers, w)
+		close(w.events)
+	}
+}
+
+// notify must be called with mu held.
+func (m *MemoryClient) notify(key string) {
+	for w := range m.watchers {
+		if strings.HasPrefix(key, w.prefix) {
+			select {
+			case w.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
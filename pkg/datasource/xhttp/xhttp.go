@@ -0,0 +1,270 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xhttp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultInterval means the default interval between two polls
+	defaultInterval = 30 * time.Second
+	// defaultTimeout means the default timeout of a single request
+	defaultTimeout    = 10 * time.Second
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// DataSource http provider, implements conf.DataSource.
+// The document is polled with If-None-Match, the last good content is kept
+// when the server fails.
+type DataSource struct {
+	url    string
+	client *http.Client
+	header http.Header
+
+	interval   time.Duration
+	timeout    time.Duration
+	longPoll   time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.RWMutex
+	content []byte
+	etag    string
+
+	changed   chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Option ...
+type Option func(ds *DataSource)
+
+// WithClient 设置发送请求的http.Client
+func WithClient(client *http.Client) Option {
+	return func(ds *DataSource) {
+		ds.client = client
+	}
+}
+
+// WithHeader 设置请求头, 如鉴权信息
+func WithHeader(key, value string) Option {
+	return func(ds *DataSource) {
+		ds.header.Add(key, value)
+	}
+}
+
+// WithInterval 设置轮询间隔
+func WithInterval(d time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.interval = d
+	}
+}
+
+// WithTimeout 设置单次请求的超时时间
+func WithTimeout(d time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.timeout = d
+	}
+}
+
+// WithLongPoll 开启长轮询, 请求携带 Prefer: wait=<seconds> 头,
+// 服务端在配置未变更时最多挂起wait后返回304, 客户端收到响应后立即发起下一次请求,
+// 未变更的响应在wait/2内返回时视为服务端不支持长轮询, 等待interval后再请求
+func WithLongPoll(wait time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.longPoll = wait
+	}
+}
+
+// WithBackoff 设置请求失败后的重试间隔, 从min开始指数增长, 不超过max
+func WithBackoff(min, max time.Duration) Option {
+	return func(ds *DataSource) {
+		ds.minBackoff, ds.maxBackoff = min, max
+	}
+}
+
+// NewDataSource returns new http DataSource, the document at url is fetched before it returns.
+// if watch is true, url is polled and changes are signaled through IsConfigChanged.
+func NewDataSource(url string, watch bool, opts ...Option) (*DataSource, error) {
+	ds := &DataSource{
+		url:        url,
+		client:     http.DefaultClient,
+		header:     make(http.Header),
+		interval:   defaultInterval,
+		timeout:    defaultTimeout,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		changed:    make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	ds.ctx, ds.cancel = context.WithCancel(context.Background())
+
+	if _, err := ds.fetch(); err != nil {
+		ds.cancel()
+		return nil, err
+	}
+
+	if watch {
+		ds.wg.Add(1)
+		go ds.watch()
+	}
+	return ds, nil
+}
+
+// ReadConfig returns the last good content.
+func (ds *DataSource) ReadConfig() ([]byte, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return append([]byte(nil), ds.content...), nil
+}
+
+// String returns the url, it names the configuration layer the document is loaded into.
+func (ds *DataSource) String() string {
+	return ds.url
+}
+
+// IsConfigChanged returns a channel for notification when the config changed.
+// the channel is closed after Close is called.
+func (ds *DataSource) IsConfigChanged() <-chan struct{} {
+	return ds.changed
+}
+
+// Close stops polling and closes the change channel.
+func (ds *DataSource) Close() error {
+	ds.closeOnce.Do(func() {
+		ds.cancel()
+		ds.wg.Wait()
+		close(ds.changed)
+	})
+	return nil
+}
+
+func (ds *DataSource) watch() {
+	defer ds.wg.Done()
+
+	failures := 0
+	for {
+		start := time.Now()
+		changed, err := ds.fetch()
+		if changed {
+			select {
+			case ds.changed <- struct{}{}:
+			default:
+			}
+		}
+
+		wait := ds.interval
+		if ds.longPoll > 0 && ds.etagged() && (changed || time.Since(start) >= ds.longPoll/2) {
+			// 服务端已挂起请求直到变更或超时, 不支持长轮询的服务端立即返回时仍按interval轮询
+			wait = 0
+		}
+		if err != nil {
+			failures++
+			wait = ds.backoff(failures)
+		} else {
+			failures = 0
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ds.ctx.Done():
+			return
+		}
+	}
+}
+
+func (ds *DataSource) etagged() bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.etag != ""
+}
+
+// backoff returns the delay after n consecutive failures.
+func (ds *DataSource) backoff(n int) time.Duration {
+	d := float64(ds.minBackoff) * math.Pow(2, float64(n-1))
+	if d > float64(ds.maxBackoff) {
+		return ds.maxBackoff
+	}
+	return time.Duration(d)
+}
+
+// fetch requests the document, changed is true if a different content is received.
+func (ds *DataSource) fetch() (changed bool, err error) {
+	timeout := ds.timeout + ds.longPoll
+	ctx, cancel := context.WithTimeout(ds.ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, ds.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range ds.header {
+		req.Header[key] = values
+	}
+
+	ds.mu.RLock()
+	etag := ds.etag
+	ds.mu.RUnlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+		if ds.longPoll > 0 {
+			req.Header.Set("Prefer", "wait="+strconv.Itoa(int(math.Ceil(ds.longPoll.Seconds()))))
+		}
+	}
+
+	resp, err := ds.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return false, nil
+	default:
+		return false, errors.Errorf("fetch %s: unexpected status %s", ds.url, resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, errors.Wrapf(err, "fetch %s", ds.url)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.etag = resp.Header.Get("ETag")
+	if bytes.Equal(ds.content, content) {
+		return false, nil
+	}
+	ds.content = content
+	return true, nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mesment/sparrow/pkg/conf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer serves a versioned document, requests carrying Prefer: wait
+// are held until the document changes.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	content  string
+	version  int
+	status   int
+	requests int
+	notified chan struct{}
+}
+
+func newTestServer(t *testing.T, content string) *testServer {
+	s := &testServer{content: content, version: 1, status: http.StatusOK, notified: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) set(content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content = content
+	s.version++
+	close(s.notified)
+	s.notified = make(chan struct{})
+}
+
+func (s *testServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *testServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	etag := `"` + strconv.Itoa(s.version) + `"`
+	notified := s.notified
+	s.mu.Unlock()
+
+	if r.Header.Get("If-None-Match") == etag {
+		if strings.HasPrefix(r.Header.Get("Prefer"), "wait=") {
+			select {
+			case <-notified:
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != http.StatusOK {
+		w.WriteHeader(s.status)
+		return
+	}
+	etag = `"` + strconv.Itoa(s.version) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write([]byte(s.content))
+}
+
+func waitChanged(t *testing.T, ds *DataSource) {
+	select {
+	case <-ds.IsConfigChanged():
+	case <-time.After(3 * time.Second):
+		t.Fatal("change not signaled")
+	}
+}
+
+func TestDataSource_ReadConfig(t *testing.T) {
+	s := newTestServer(t, `{"app":{"mode":"dev"}}`)
+	ds, err := NewDataSource(s.URL, false)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"app":{"mode":"dev"}}`, string(content))
+	assert.Equal(t, s.URL, ds.String())
+
+	s.setStatus(http.StatusInternalServerError)
+	_, err = NewDataSource(s.URL, false)
+	assert.Error(t, err)
+}
+
+func TestDataSource_Poll(t *testing.T) {
+	s := newTestServer(t, `{}`)
+	ds, err := NewDataSource(s.URL, true, WithInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer ds.Close()
+
+	// unchanged document is answered with 304 and not signaled
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-ds.IsConfigChanged():
+		t.Fatal("unexpected change signaled")
+	default:
+	}
+
+	s.set(`{"a":1}`)
+	waitChanged(t, ds)
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(content))
+}
+
+func TestDataSource_LongPoll(t *testing.T) {
+	s := newTestServer(t, `{}`)
+	ds, err := NewDataSource(s.URL, true, WithInterval(time.Hour), WithLongPoll(time.Second))
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	s.set(`{"a":1}`)
+	waitChanged(t, ds)
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(content))
+
+	// the request held by the server is canceled
+	start := time.Now()
+	require.NoError(t, ds.Close())
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestDataSource_LongPollUnsupported(t *testing.T) {
+	// the server ignores Prefer: wait and answers 304 at once
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"1"`)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer s.Close()
+
+	ds, err := NewDataSource(s.URL, true, WithInterval(50*time.Millisecond), WithLongPoll(time.Second))
+	require.NoError(t, err)
+	defer ds.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	// polled every interval instead of in a tight loop
+	n := atomic.LoadInt32(&requests)
+	assert.True(t, n <= 6, "%d requests", n)
+}
+
+func TestDataSource_Backoff(t *testing.T) {
+	s := newTestServer(t, `{"a":1}`)
+	ds, err := NewDataSource(s.URL, true,
+		WithInterval(time.Millisecond),
+		WithBackoff(20*time.Millisecond, 40*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	s.setStatus(http.StatusServiceUnavailable)
+	before := s.count()
+	time.Sleep(200 * time.Millisecond)
+	// retried with backoff instead of every millisecond
+	assert.True(t, s.count()-before < 15, "%d requests", s.count()-before)
+
+	// last good content is kept
+	content, err := ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(content))
+
+	s.set(`{"a":2}`)
+	s.setStatus(http.StatusOK)
+	waitChanged(t, ds)
+	content, err = ds.ReadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":2}`, string(content))
+}
+
+func TestDataSource_LoadFromDataSource(t *testing.T) {
+	s := newTestServer(t, `{"app":{"mode":"dev"}}`)
+	ds, err := NewDataSource(s.URL, true, WithInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer ds.Close()
+
+	c := conf.New()
+	require.NoError(t, c.LoadFromDataSource(ds, json.Unmarshal))
+	assert.Equal(t, "dev", c.GetString("app.mode"))
+	assert.Equal(t, s.URL, c.Source("app.mode"))
+
+	reloaded := make(chan struct{}, 1)
+	c.OnChange(func(*conf.Configuration) {
+		reloaded <- struct{}{}
+	})
+
+	s.set(`{"app":{"mode":"prod"}}`)
+	select {
+	case <-reloaded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("configuration not reloaded")
+	}
+	assert.Equal(t, "prod", c.GetString("app.mode"))
+}
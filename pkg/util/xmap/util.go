@@ -17,6 +17,7 @@ package xmap
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/mesment/sparrow/pkg/util/xcast"
@@ -35,7 +36,7 @@ func MergeStringMap(dest, src map[string]interface{}) {
 		svType := reflect.TypeOf(sv)
 		tvType := reflect.TypeOf(tv)
 		if svType != tvType {
-			fmt.Println("continue, type is different")
+			// 类型不同时保留dest中的值
 			continue
 		}
 
@@ -64,24 +65,51 @@ func ToMapStringInterface(src map[interface{}]interface{}) map[string]interface{
 	return tgt
 }
 
-// InsensitiviseMap insensitivise map
+// InsensitiviseMap lowercases the keys of m recursively in place,
+// maps under keys differing only in case are merged.
 func InsensitiviseMap(m map[string]interface{}) {
-	for key, val := range m {
-		switch val.(type) {
-		case map[interface{}]interface{}:
-			InsensitiviseMap(xcast.ToStringMap(val))
-		case map[string]interface{}:
-			InsensitiviseMap(val.(map[string]interface{}))
-		}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	// 按key排序, 冲突时的合并结果与遍历顺序无关
+	sort.Strings(keys)
 
+	for _, key := range keys {
+		val := insensitivise(m[key])
 		lower := strings.ToLower(key)
 		if key != lower {
 			delete(m, key)
 		}
+		if dst, ok := m[lower].(map[string]interface{}); ok && key != lower {
+			if src, ok := val.(map[string]interface{}); ok {
+				MergeStringMap(dst, src)
+				continue
+			}
+		}
 		m[lower] = val
 	}
 }
 
+func insensitivise(val interface{}) interface{} {
+	switch vv := val.(type) {
+	case map[interface{}]interface{}:
+		m := ToMapStringInterface(vv)
+		InsensitiviseMap(m)
+		return m
+	case map[string]interface{}:
+		InsensitiviseMap(vv)
+		return vv
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = insensitivise(item)
+		}
+		return vv
+	default:
+		return val
+	}
+}
+
 // DeepSearchInMap deep search in map
 func DeepSearchInMap(m map[string]interface{}, paths ...string) map[string]interface{} {
 	//深度拷贝
@@ -108,3 +136,37 @@ func DeepSearchInMap(m map[string]interface{}, paths ...string) map[string]inter
 	}
 	return mtmp
 }
+
+// CloneStringMap deep copy map, nested maps and slices are copied as well
+func CloneStringMap(src map[string]interface{}) map[string]interface{} {
+	if src == nil {
+		return nil
+	}
+	return Clone(src).(map[string]interface{})
+}
+
+// Clone deep copy val, maps and slices are copied recursively
+func Clone(val interface{}) interface{} {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			m[k] = Clone(v)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(vv))
+		for k, v := range vv {
+			m[k] = Clone(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(vv))
+		for i, v := range vv {
+			s[i] = Clone(v)
+		}
+		return s
+	default:
+		return val
+	}
+}
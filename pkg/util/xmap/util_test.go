@@ -15,6 +15,8 @@
 package xmap
 
 import (
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 
@@ -111,3 +113,76 @@ func TestMergeStringMap(t *testing.T) {
 		})
 	}
 }
+
+func TestCloneStringMap(t *testing.T) {
+	src := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": "c",
+			"d": []interface{}{map[string]interface{}{"e": 1}},
+		},
+	}
+	dst := CloneStringMap(src)
+	if !reflect.DeepEqual(src, dst) {
+		spew.Dump(dst)
+		t.FailNow()
+	}
+
+	dst["a"].(map[string]interface{})["b"] = "x"
+	dst["a"].(map[string]interface{})["d"].([]interface{})[0].(map[string]interface{})["e"] = 2
+	if src["a"].(map[string]interface{})["b"] != "c" ||
+		src["a"].(map[string]interface{})["d"].([]interface{})[0].(map[string]interface{})["e"] != 1 {
+		spew.Dump(src)
+		t.FailNow()
+	}
+}
+
+func TestInsensitiviseMap(t *testing.T) {
+	m := map[string]interface{}{
+		"Logger": map[string]interface{}{"Level": "debug"},
+		"logger": map[string]interface{}{"path": "/tmp"},
+		"Servers": []interface{}{
+			map[interface{}]interface{}{"Host": "a"},
+		},
+	}
+	InsensitiviseMap(m)
+	tar := map[string]interface{}{
+		"logger": map[string]interface{}{"level": "debug", "path": "/tmp"},
+		"servers": []interface{}{
+			map[string]interface{}{"host": "a"},
+		},
+	}
+	if !reflect.DeepEqual(tar, m) {
+		spew.Dump(m)
+		t.FailNow()
+	}
+}
+
+func TestInsensitiviseMapConflict(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	m := map[string]interface{}{
+		"DB": map[string]interface{}{"Port": 3306},
+		"db": map[string]interface{}{"port": "3307"},
+	}
+	InsensitiviseMap(m)
+	w.Close()
+	os.Stdout = stdout
+
+	// values of different types keep the lowercase key, nothing is printed
+	tar := map[string]interface{}{
+		"db": map[string]interface{}{"port": "3307"},
+	}
+	if !reflect.DeepEqual(tar, m) {
+		spew.Dump(m)
+		t.FailNow()
+	}
+	if out, _ := ioutil.ReadAll(r); len(out) > 0 {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
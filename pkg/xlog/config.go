@@ -1,8 +1,6 @@
-
 // 修改内容:
 // 添加配置日志输出方式,支持同时输出到控制台和文件
 
-
 //``````````````````````````````````````````````````````````````````
 // Copyright 2020 Douyu
 //
@@ -32,21 +30,27 @@ import (
 // Config ...
 type Config struct {
 	// 日志是否输出到控制台
-	EnableConsole     bool
+	EnableConsole bool
 	// 控制台日志显示格式是否以json格式显示
 	ConsoleJSONFormat bool
+	// ConsoleEncoding 控制台日志编码格式, 如json、console、logfmt, 不为空时忽略ConsoleJSONFormat
+	ConsoleEncoding string
 	// 控制台日志输出级别
-	ConsoleLevel      string
+	ConsoleLevel string
 	// 日志是否输出到文件
-	EnableFile        bool
+	EnableFile bool
 	// 文件日志显示格式是否以json格式显示
-	FileJSONFormat    bool
+	FileJSONFormat bool
+	// FileEncoding 文件日志编码格式, 如json、console、logfmt, 不为空时忽略FileJSONFormat
+	FileEncoding string
 	// Dir 日志文件输出目录
 	Dir string
 	// Name 日志文件名称
 	Name string
 	// Level 日志文件初始等级
 	Level string
+	// Outputs 日志输出列表, 与EnableConsole、EnableFile同时生效
+	Outputs []OutputConfig
 	// 日志初始化字段
 	Fields []zap.Field
 	// 是否添加调用者信息
@@ -54,18 +58,18 @@ type Config struct {
 	// 日志前缀
 	Prefix string
 	// 日志输出文件最大长度，超过改值则截断（单位 M）
-	MaxSize   int
+	MaxSize int
 	// 保存日志文件最长天数
-	MaxAge    int
+	MaxAge int
 	// 保存日志文件最大个数
 	MaxBackup int
 	// 日志磁盘刷盘间隔
-	Interval      time.Duration
-	CallerSkip    int
-	Async         bool
-	Queue         bool
-	QueueSleep    time.Duration
-	Core          zapcore.Core
+	Interval   time.Duration
+	CallerSkip int
+	Async      bool
+	Queue      bool
+	QueueSleep time.Duration
+	Core       zapcore.Core
 	// 开启日志级别颜色显示
 	Debug         bool
 	EncoderConfig *zapcore.EncoderConfig
@@ -77,6 +81,27 @@ func (config *Config) Filename() string {
 	return fmt.Sprintf("%s/%s", config.Dir, config.Name)
 }
 
+// consoleEncoding returns the encoding of console logs.
+func (config *Config) consoleEncoding() string {
+	return encoding(config.ConsoleEncoding, config.ConsoleJSONFormat)
+}
+
+// fileEncoding returns the encoding of file logs.
+func (config *Config) fileEncoding() string {
+	return encoding(config.FileEncoding, config.FileJSONFormat)
+}
+
+func encoding(name string, isJSON bool) string {
+	switch {
+	case name != "":
+		return name
+	case isJSON:
+		return EncodingJSON
+	default:
+		return EncodingConsole
+	}
+}
+
 // RawConfig ...
 func RawConfig(key string) *Config {
 	var config = DefaultConfig()
@@ -95,19 +120,20 @@ func StdConfig(name string) *Config {
 // DefaultConfig ...
 func DefaultConfig() *Config {
 	return &Config{
-		Name:          "default.log",
-		Dir:           ".",
-		Level:         "info",
-		MaxSize:       500, // 500M
-		MaxAge:        1,   // 1 day
-		MaxBackup:     10,  // 10 backup
-		Interval:      24 * time.Hour,
-		CallerSkip:    1,
-		AddCaller:     true,
-		Async:         true,
-		Queue:         false,
-		QueueSleep:    100 * time.Millisecond,
-		EncoderConfig: DefaultZapConfig(),
+		Name:           "default.log",
+		Dir:            ".",
+		Level:          "info",
+		FileJSONFormat: true,
+		MaxSize:        500, // 500M
+		MaxAge:         1,   // 1 day
+		MaxBackup:      10,  // 10 backup
+		Interval:       24 * time.Hour,
+		CallerSkip:     1,
+		AddCaller:      true,
+		Async:          true,
+		Queue:          false,
+		QueueSleep:     100 * time.Millisecond,
+		EncoderConfig:  DefaultZapConfig(),
 	}
 }
 
@@ -126,5 +152,3 @@ func (config Config) Build() *Logger {
 	}
 	return logger
 }
-
-
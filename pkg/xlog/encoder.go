@@ -0,0 +1,66 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 内置的日志编码格式
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+	EncodingLogfmt  = "logfmt"
+)
+
+// EncoderFactory constructs an encoder with the encoder config of the sink.
+type EncoderFactory func(zapcore.EncoderConfig) (zapcore.Encoder, error)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFactory{
+		EncodingJSON: func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewJSONEncoder(config), nil
+		},
+		EncodingConsole: func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return zapcore.NewConsoleEncoder(config), nil
+		},
+		EncodingLogfmt: func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+			return NewLogfmtEncoder(config), nil
+		},
+	}
+)
+
+// RegisterEncoder registers the encoder factory of encoding name, the name can be
+// used as the Encoding of sinks. Registering an existing name replaces it.
+func RegisterEncoder(name string, factory EncoderFactory) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	encoders[name] = factory
+}
+
+// newEncoder constructs the encoder of encoding name.
+func newEncoder(name string, config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+	encodersMu.RLock()
+	factory, ok := encoders[name]
+	encodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("xlog: unknown encoding %q", name)
+	}
+	return factory(config)
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestConfig_Encoding(t *testing.T) {
+	assert.Equal(t, EncodingConsole, (&Config{}).consoleEncoding())
+	assert.Equal(t, EncodingJSON, (&Config{ConsoleJSONFormat: true}).consoleEncoding())
+	assert.Equal(t, "custom", (&Config{ConsoleJSONFormat: true, ConsoleEncoding: "custom"}).consoleEncoding())
+	assert.Equal(t, EncodingJSON, DefaultConfig().fileEncoding())
+	assert.Equal(t, EncodingConsole, (&Config{}).fileEncoding())
+}
+
+func buildFileLogger(t *testing.T, config *Config) string {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config.EnableFile = true
+	config.Dir = dir
+	config.Async = false
+	config.AddCaller = false
+	logger := config.Build()
+	logger.Info("hello", String("a", "b"))
+	require.NoError(t, logger.Flush())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, config.Name))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestLogger_FileEncoding(t *testing.T) {
+	config := DefaultConfig()
+	content := buildFileLogger(t, config)
+	assert.True(t, strings.HasPrefix(content, `{"lv":"info"`), content)
+	assert.Contains(t, content, `"msg":"hello","a":"b"}`)
+
+	config = DefaultConfig()
+	config.FileJSONFormat = false
+	content = buildFileLogger(t, config)
+	assert.Contains(t, content, "\tinfo\thello\t{\"a\": \"b\"}\n")
+
+	RegisterEncoder("test", func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		config.MessageKey = "message"
+		return zapcore.NewJSONEncoder(config), nil
+	})
+	config = DefaultConfig()
+	config.FileEncoding = "test"
+	content = buildFileLogger(t, config)
+	assert.Contains(t, content, `"message":"hello"`)
+
+	config = DefaultConfig()
+	config.FileEncoding = "unknown"
+	assert.PanicsWithError(t, `xlog: unknown encoding "unknown"`, func() { buildFileLogger(t, config) })
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// journaldSocket is the socket of the journald native protocol.
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journaldWriter sends entries to journald over its unix datagram socket with the native protocol,
+// the encoded entry is the MESSAGE and the level is mapped to PRIORITY.
+type journaldWriter struct {
+	mu      sync.Mutex
+	address string
+	tag     string
+	conn    net.Conn
+}
+
+func newJournaldWriter(out *OutputConfig) (zapcore.WriteSyncer, error) {
+	w := &journaldWriter{
+		address: out.Address,
+		tag:     syslogTag(out.Tag),
+	}
+	if w.address == "" {
+		w.address = journaldSocket
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect must be called with mu held.
+func (w *journaldWriter) connect() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	conn, err := net.Dial("unixgram", w.address)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p with info level.
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now()}, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry sends the encoded entry p, reconnects once if sending fails.
+func (w *journaldWriter) WriteEntry(ent zapcore.Entry, p []byte) error {
+	var buf bytes.Buffer
+	journaldField(&buf, "PRIORITY", strconv.Itoa(severity(ent.Level)))
+	journaldField(&buf, "SYSLOG_IDENTIFIER", w.tag)
+	journaldField(&buf, "MESSAGE", string(bytes.TrimRight(p, "\r\n")))
+	if ent.LoggerName != "" {
+		journaldField(&buf, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		journaldField(&buf, "CODE_FILE", ent.Caller.File)
+		journaldField(&buf, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			journaldField(&buf, "CODE_FUNC", fn.Name())
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		if err := w.send(buf.Bytes()); err == nil {
+			return nil
+		}
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	return w.send(buf.Bytes())
+}
+
+// send must be called with mu held.
+func (w *journaldWriter) send(p []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := w.conn.Write(p)
+	return err
+}
+
+func (w *journaldWriter) Sync() error {
+	return nil
+}
+
+// Close closes the connection, a later write reconnects.
+func (w *journaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// journaldField writes a field of the native protocol, values containing
+// newlines are written as the name, a little endian uint64 length and the value.
+func journaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseJournald decodes a datagram of the journald native protocol.
+func parseJournald(t *testing.T, data []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		require.True(t, idx > 0)
+		line := string(data[:idx])
+		data = data[idx+1:]
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			fields[line[:eq]] = line[eq+1:]
+			continue
+		}
+		size := binary.LittleEndian.Uint64(data[:8])
+		fields[line] = string(data[8 : 8+size])
+		data = data[8+size+1:]
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	address := filepath.Join(dir, "socket")
+	conn, err := net.ListenPacket("unixgram", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	config := DefaultConfig()
+	config.Outputs = []OutputConfig{{Type: OutputJournald, Address: address, Tag: "app", Encoding: EncodingLogfmt}}
+	logger := config.Build()
+	logger.Warn("line1\nline2", String("a", "b"))
+
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	fields := parseJournald(t, buf[:n])
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.Equal(t, "app", fields["SYSLOG_IDENTIFIER"])
+	assert.Regexp(t, `^ts=\S+ lv=warn caller=\S+ msg="line1\\nline2" a=b$`, fields["MESSAGE"])
+	assert.Equal(t, "journald_test.go", filepath.Base(fields["CODE_FILE"]))
+	assert.NotEmpty(t, fields["CODE_LINE"])
+	assert.True(t, strings.HasSuffix(fields["CODE_FUNC"], "TestJournald"), fields["CODE_FUNC"])
+
+	var multiline bytes.Buffer
+	journaldField(&multiline, "MESSAGE", "a\nb")
+	assert.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", multiline.String())
+}
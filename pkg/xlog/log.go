@@ -22,14 +22,12 @@ package xlog
 import (
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 
 	"github.com/mesment/sparrow/pkg/conf"
-	"github.com/mesment/sparrow/pkg/defers"
 	"github.com/mesment/sparrow/pkg/util/xcolor"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -63,6 +61,8 @@ type (
 		lv      *zap.AtomicLevel
 		config  Config
 		sugar   *zap.SugaredLogger
+		// closers 关闭各输出, 释放网络输出的名称等资源
+		closers []CloseFunc
 	}
 )
 
@@ -111,40 +111,24 @@ func newLogger(config *Config) *Logger {
 		panic(err)
 	}
 
-	encoderConfig := *config.EncoderConfig //getEncoder(config.ConsoleJSONFormat)
-
-	if config.EnableConsole {
-		writer := zapcore.Lock(os.Stdout)
-		consoleLevel := zap.NewAtomicLevelAt(getZapLevel(config.ConsoleLevel))
-		if config.Async {
-			var close CloseFunc
-			writer, close = Buffer(writer, defaultBufferSize, defaultFlushInterval)
-
-			defers.Register(close)
-		}
-		core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), writer, consoleLevel)
-
-		cores = append(cores, core)
-	}
-
-	if config.EnableFile {
+	if config.EnableFile && config.Name == "" {
 		now := time.Now()
-		if config.Name == "" {
-			logPath := filepath.Base(config.Dir)
-			logName := logPath + "/" + fmt.Sprintf("%04d%02d%02d%02d%02d%02d.log", now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second())
-			config.Name = logName
-		}
-		writer := zapcore.AddSync(newRotate(config))
-		if config.Async {
-			var close CloseFunc
-			writer, close = Buffer(writer, defaultBufferSize, defaultFlushInterval)
-
-			defers.Register(close)
+		logPath := filepath.Base(config.Dir)
+		logName := logPath + "/" + fmt.Sprintf("%04d%02d%02d%02d%02d%02d.log", now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second())
+		config.Name = logName
+	}
+	var closers []CloseFunc
+	for _, out := range config.outputs() {
+		core, close, err := newCore(config, out, lv)
+		if err != nil {
+			// 关闭已创建的输出, 修正配置后可重新创建
+			for _, close := range closers {
+				close()
+			}
+			panic(err)
 		}
-		//还原日志显示级别，日志文件里不显示日志级别颜色
-		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
-		core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), writer, lv)
 		cores = append(cores, core)
+		closers = append(closers, close)
 	}
 	combinedCore := zapcore.NewTee(cores...)
 
@@ -157,21 +141,10 @@ func newLogger(config *Config) *Logger {
 		lv:      &lv,
 		config:  *config,
 		sugar:   zapLogger.Sugar(),
+		closers: closers,
 	}
 }
 
-func getEncoder(isJSON bool) zapcore.Encoder {
-	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoderConfig.LevelKey = "lv"
-	encoderConfig.TimeKey = "ts" // This will change the key from to ts
-	//Rest of the code remains same
-	if isJSON {
-		return zapcore.NewJSONEncoder(encoderConfig)
-	}
-	return zapcore.NewConsoleEncoder(encoderConfig)
-}
-
 func getZapLevel(level string) zapcore.Level {
 	switch level {
 	case "debug":
@@ -201,8 +174,8 @@ func (logger *Logger) Raw() *zap.Logger {
 
 // AutoLevel ...
 func (logger *Logger) AutoLevel(confKey string) {
-	conf.OnChange(func(config *conf.Configuration) {
-		lvText := strings.ToLower(config.GetString(confKey))
+	conf.Watch(confKey, func([]conf.Change) {
+		lvText := strings.ToLower(conf.GetString(confKey))
 		if lvText != "" {
 			logger.Info("update level", String("level", lvText), String("name", logger.config.Name))
 			logger.lv.UnmarshalText([]byte(lvText))
@@ -220,6 +193,18 @@ func (logger *Logger) Flush() error {
 	return logger.desugar.Sync()
 }
 
+// Close flushes and closes the outputs, loggers derived by With share them.
+func (logger *Logger) Close() error {
+	_ = logger.desugar.Sync()
+	var err error
+	for _, close := range logger.closers {
+		if cerr := close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
 // DefaultZapConfig ...
 func DefaultZapConfig() *zapcore.EncoderConfig {
 	return &zapcore.EncoderConfig{
@@ -458,5 +443,6 @@ func (logger *Logger) With(fields ...Field) *Logger {
 		lv:      logger.lv,
 		sugar:   desugarLogger.Sugar(),
 		config:  logger.config,
+		closers: logger.closers,
 	}
 }
@@ -0,0 +1,393 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const hex = "0123456789abcdef"
+
+var logfmtPool = buffer.NewPool()
+
+// logfmtEncoder encodes entries as logfmt key=value lines, nested objects and
+// arrays are flattened to dotted keys: user.name=foo tags.0=a tags.1=b.
+type logfmtEncoder struct {
+	*zapcore.EncoderConfig
+	buf *buffer.Buffer
+	// namespaces 由OpenNamespace和嵌套对象产生的key前缀
+	namespaces []string
+}
+
+// NewLogfmtEncoder creates an encoder writing logfmt lines.
+func NewLogfmtEncoder(config zapcore.EncoderConfig) zapcore.Encoder {
+	return &logfmtEncoder{
+		EncoderConfig: &config,
+		buf:           logfmtPool.Get(),
+	}
+}
+
+// AddArray writes the elements as key.0, key.1 ...
+func (enc *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	return arr.MarshalLogArray(&logfmtArrayEncoder{enc: enc, key: key, indexed: true})
+}
+
+// AddObject writes the fields of obj prefixed with key.
+func (enc *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	n := len(enc.namespaces)
+	enc.namespaces = append(enc.namespaces, key)
+	err := obj.MarshalLogObject(enc)
+	// 同时丢弃对象内部通过OpenNamespace打开的前缀
+	enc.namespaces = enc.namespaces[:n]
+	return err
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, val []byte) {
+	enc.addKey(key)
+	enc.appendString(string(val))
+}
+
+func (enc *logfmtEncoder) AddBool(key string, val bool) {
+	enc.addKey(key)
+	enc.buf.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, val complex128) {
+	enc.addKey(key)
+	r, i := real(val), imag(val)
+	enc.buf.AppendFloat(r, 64)
+	if i >= 0 || math.IsNaN(i) {
+		enc.buf.AppendByte('+')
+	}
+	enc.buf.AppendFloat(i, 64)
+	enc.buf.AppendByte('i')
+}
+
+func (enc *logfmtEncoder) AddComplex64(key string, val complex64) {
+	enc.AddComplex128(key, complex128(val))
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, val time.Duration) {
+	if enc.EncodeDuration == nil || !enc.encodeScalar(key, func(pae zapcore.PrimitiveArrayEncoder) {
+		enc.EncodeDuration(val, pae)
+	}) {
+		enc.AddInt64(key, int64(val))
+	}
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, val float64) {
+	enc.addKey(key)
+	enc.buf.AppendFloat(val, 64)
+}
+
+func (enc *logfmtEncoder) AddFloat32(key string, val float32) {
+	enc.addKey(key)
+	enc.buf.AppendFloat(float64(val), 32)
+}
+
+func (enc *logfmtEncoder) AddInt(key string, val int)     { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt32(key string, val int32) { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt16(key string, val int16) { enc.AddInt64(key, int64(val)) }
+func (enc *logfmtEncoder) AddInt8(key string, val int8)   { enc.AddInt64(key, int64(val)) }
+
+func (enc *logfmtEncoder) AddInt64(key string, val int64) {
+	enc.addKey(key)
+	enc.buf.AppendInt(val)
+}
+
+func (enc *logfmtEncoder) AddString(key, val string) {
+	enc.addKey(key)
+	enc.appendString(val)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, val time.Time) {
+	if enc.EncodeTime == nil || !enc.encodeScalar(key, func(pae zapcore.PrimitiveArrayEncoder) {
+		enc.EncodeTime(val, pae)
+	}) {
+		enc.AddInt64(key, val.UnixNano())
+	}
+}
+
+func (enc *logfmtEncoder) AddUint(key string, val uint)       { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint32(key string, val uint32)   { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint16(key string, val uint16)   { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUint8(key string, val uint8)     { enc.AddUint64(key, uint64(val)) }
+func (enc *logfmtEncoder) AddUintptr(key string, val uintptr) { enc.AddUint64(key, uint64(val)) }
+
+func (enc *logfmtEncoder) AddUint64(key string, val uint64) {
+	enc.addKey(key)
+	enc.buf.AppendUint(val)
+}
+
+// AddReflected marshals val to JSON and flattens the objects and arrays to dotted keys.
+func (enc *logfmtEncoder) AddReflected(key string, val interface{}) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return err
+	}
+	enc.addDecoded(key, decoded)
+	return nil
+}
+
+func (enc *logfmtEncoder) addDecoded(key string, val interface{}) {
+	switch vv := val.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			enc.addDecoded(key+"."+k, vv[k])
+		}
+	case []interface{}:
+		for i, item := range vv {
+			enc.addDecoded(key+"."+strconv.Itoa(i), item)
+		}
+	case string:
+		enc.AddString(key, vv)
+	case json.Number:
+		enc.addKey(key)
+		enc.buf.AppendString(vv.String())
+	case bool:
+		enc.AddBool(key, vv)
+	default:
+		enc.addKey(key)
+		enc.buf.AppendString("null")
+	}
+}
+
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.namespaces = append(enc.namespaces, key)
+}
+
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *logfmtEncoder) clone() *logfmtEncoder {
+	return &logfmtEncoder{
+		EncoderConfig: enc.EncoderConfig,
+		buf:           logfmtPool.Get(),
+		namespaces:    append([]string(nil), enc.namespaces...),
+	}
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+	// 元数据不受命名空间影响
+	final.namespaces = nil
+
+	if final.TimeKey != "" {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if final.LevelKey != "" && final.EncodeLevel != nil {
+		final.encodeScalar(final.LevelKey, func(pae zapcore.PrimitiveArrayEncoder) {
+			final.EncodeLevel(ent.Level, pae)
+		})
+	}
+	if ent.LoggerName != "" && final.NameKey != "" {
+		nameEncoder := final.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = zapcore.FullNameEncoder
+		}
+		final.encodeScalar(final.NameKey, func(pae zapcore.PrimitiveArrayEncoder) {
+			nameEncoder(ent.LoggerName, pae)
+		})
+	}
+	if ent.Caller.Defined && final.CallerKey != "" && final.EncodeCaller != nil {
+		final.encodeScalar(final.CallerKey, func(pae zapcore.PrimitiveArrayEncoder) {
+			final.EncodeCaller(ent.Caller, pae)
+		})
+	}
+	if final.MessageKey != "" {
+		final.AddString(final.MessageKey, ent.Message)
+	}
+
+	if enc.buf.Len() > 0 {
+		final.separate()
+		final.buf.Write(enc.buf.Bytes())
+	}
+	final.namespaces = append(final.namespaces, enc.namespaces...)
+	for _, field := range fields {
+		field.AddTo(final)
+	}
+
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.namespaces = nil
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+	if final.LineEnding != "" {
+		final.buf.AppendString(final.LineEnding)
+	} else {
+		final.buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return final.buf, nil
+}
+
+// encodeScalar writes the values appended by fn under key, returns false if nothing appended.
+func (enc *logfmtEncoder) encodeScalar(key string, fn func(zapcore.PrimitiveArrayEncoder)) bool {
+	n := enc.buf.Len()
+	fn(&logfmtArrayEncoder{enc: enc, key: key})
+	return enc.buf.Len() > n
+}
+
+func (enc *logfmtEncoder) separate() {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+}
+
+// addKey writes the key prefixed by the namespaces, characters not allowed in keys are replaced with '_'.
+func (enc *logfmtEncoder) addKey(key string) {
+	enc.separate()
+	for _, ns := range enc.namespaces {
+		enc.appendKey(ns)
+		enc.buf.AppendByte('.')
+	}
+	enc.appendKey(key)
+	enc.buf.AppendByte('=')
+}
+
+func (enc *logfmtEncoder) appendKey(key string) {
+	if key == "" {
+		enc.buf.AppendByte('_')
+		return
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			r = '_'
+		}
+		enc.buf.AppendString(string(r))
+	}
+}
+
+// appendString writes s, quoted and escaped if it is empty or contains spaces, '=', '"' or control characters.
+func (enc *logfmtEncoder) appendString(s string) {
+	if !needsQuote(s) {
+		enc.buf.AppendString(s)
+		return
+	}
+	enc.buf.AppendByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '\\' || r == '"':
+			enc.buf.AppendByte('\\')
+			enc.buf.AppendByte(byte(r))
+		case r == '\n':
+			enc.buf.AppendString(`\n`)
+		case r == '\r':
+			enc.buf.AppendString(`\r`)
+		case r == '\t':
+			enc.buf.AppendString(`\t`)
+		case r < ' ' || r == 0x7f:
+			enc.buf.AppendString(`\u00`)
+			enc.buf.AppendByte(hex[r>>4])
+			enc.buf.AppendByte(hex[r&0xf])
+		case r == utf8.RuneError && size == 1:
+			enc.buf.AppendString(`\ufffd`)
+		default:
+			enc.buf.AppendString(s[i-size : i])
+		}
+	}
+	enc.buf.AppendByte('"')
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
+
+// logfmtArrayEncoder writes the appended values under key, indexed arrays
+// write each element as key.0, key.1 ...
+type logfmtArrayEncoder struct {
+	enc     *logfmtEncoder
+	key     string
+	indexed bool
+	n       int
+}
+
+func (a *logfmtArrayEncoder) next() string {
+	if !a.indexed {
+		return a.key
+	}
+	key := a.key + "." + strconv.Itoa(a.n)
+	a.n++
+	return key
+}
+
+func (a *logfmtArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	return a.enc.AddArray(a.next(), arr)
+}
+
+func (a *logfmtArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	return a.enc.AddObject(a.next(), obj)
+}
+
+func (a *logfmtArrayEncoder) AppendReflected(val interface{}) error {
+	return a.enc.AddReflected(a.next(), val)
+}
+
+func (a *logfmtArrayEncoder) AppendBool(val bool)              { a.enc.AddBool(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendByteString(val []byte)      { a.enc.AddByteString(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendComplex128(val complex128)  { a.enc.AddComplex128(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendComplex64(val complex64)    { a.enc.AddComplex64(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendDuration(val time.Duration) { a.enc.AddDuration(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendFloat64(val float64)        { a.enc.AddFloat64(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendFloat32(val float32)        { a.enc.AddFloat32(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendInt(val int)                { a.enc.AddInt(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendInt64(val int64)            { a.enc.AddInt64(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendInt32(val int32)            { a.enc.AddInt32(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendInt16(val int16)            { a.enc.AddInt16(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendInt8(val int8)              { a.enc.AddInt8(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendString(val string)          { a.enc.AddString(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendTime(val time.Time)         { a.enc.AddTime(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUint(val uint)              { a.enc.AddUint(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUint64(val uint64)          { a.enc.AddUint64(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUint32(val uint32)          { a.enc.AddUint32(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUint16(val uint16)          { a.enc.AddUint16(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUint8(val uint8)            { a.enc.AddUint8(a.next(), val) }
+func (a *logfmtArrayEncoder) AppendUintptr(val uintptr)        { a.enc.AddUintptr(a.next(), val) }
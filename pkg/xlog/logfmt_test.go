@@ -0,0 +1,106 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logfmtUser struct {
+	Name string
+	Tags []string
+}
+
+func (u logfmtUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.Name)
+	return enc.AddArray("tags", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, tag := range u.Tags {
+			arr.AppendString(tag)
+		}
+		return nil
+	}))
+}
+
+func encodeLogfmt(t *testing.T, enc zapcore.Encoder, ent zapcore.Entry, fields ...zapcore.Field) string {
+	buf, err := enc.EncodeEntry(ent, fields)
+	require.NoError(t, err)
+	defer buf.Free()
+	return buf.String()
+}
+
+func TestLogfmtEncoder(t *testing.T) {
+	config := *DefaultZapConfig()
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	enc := NewLogfmtEncoder(config)
+	ent := zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       time.Date(2020, 8, 14, 10, 0, 0, 0, time.UTC),
+		LoggerName: "app",
+		Message:    "hello world",
+	}
+
+	assert.Equal(t, `ts=2020-08-14T10:00:00.000Z lv=warn logger=app msg="hello world"`+
+		` a=b empty="" quote="say \"hi\"" eq="a=b" nl="line1\nline2" ctrl="\u0001" bad="\ufffd"`+
+		` n=1 f=1.5 ok=true d=1.5 error=oops user.name=foo user.tags.0=a user.tags.1="b c"`+
+		` ints.0=1 ints.1=2 m.k.0=1 m.x=null a_key=x`+"\n",
+		encodeLogfmt(t, enc, ent,
+			zap.String("a", "b"),
+			zap.String("empty", ""),
+			zap.String("quote", `say "hi"`),
+			zap.String("eq", "a=b"),
+			zap.String("nl", "line1\nline2"),
+			zap.String("ctrl", "\x01"),
+			zap.String("bad", "\xff"),
+			zap.Int("n", 1),
+			zap.Float64("f", 1.5),
+			zap.Bool("ok", true),
+			zap.Duration("d", 1500*time.Millisecond),
+			zap.Error(errors.New("oops")),
+			zap.Object("user", logfmtUser{Name: "foo", Tags: []string{"a", "b c"}}),
+			zap.Ints("ints", []int{1, 2}),
+			zap.Reflect("m", map[string]interface{}{"k": []int{1}, "x": nil}),
+			zap.String("a key", "x"),
+		))
+}
+
+func TestLogfmtEncoder_Namespace(t *testing.T) {
+	config := *DefaultZapConfig()
+	config.TimeKey = ""
+	enc := NewLogfmtEncoder(config)
+	enc.AddString("svc", "api")
+	enc.OpenNamespace("req")
+	enc.AddInt("id", 1)
+
+	clone := enc.Clone()
+	ent := zapcore.Entry{Level: zapcore.InfoLevel, Message: "done", Stack: "main.go:1"}
+	assert.Equal(t, "lv=info msg=done svc=api req.id=1 req.cost=2 stack=main.go:1\n",
+		encodeLogfmt(t, clone, ent, zap.Int("cost", 2)))
+	// the fields of an entry never leak into the encoder
+	assert.Equal(t, "lv=info msg=done svc=api req.id=1\n", encodeLogfmt(t, enc, zapcore.Entry{Message: "done"}))
+}
+
+func TestConfig_LogfmtEncoding(t *testing.T) {
+	config := DefaultConfig()
+	config.FileEncoding = EncodingLogfmt
+	content := buildFileLogger(t, config)
+	assert.Regexp(t, `^ts=\S+ lv=info msg=hello a=b\n$`, content)
+}
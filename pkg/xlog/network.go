@@ -0,0 +1,487 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mesment/sparrow/pkg/defers"
+	"go.uber.org/zap/zapcore"
+)
+
+// 网络输出队列满时的处理策略
+const (
+	QueuePolicyDrop  = "drop"
+	QueuePolicyBlock = "block"
+)
+
+const (
+	defaultBatchSize       = 100
+	defaultBatchInterval   = time.Second
+	defaultQueueSize       = 10000
+	defaultMaxRetries      = 3
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 10 * time.Second
+	defaultMaxSpoolSize    = 100 << 20 // 100M
+
+	// networkTimeout bounds dialing and sending a batch
+	networkTimeout = 10 * time.Second
+	// replayChunkSize bounds the bytes sent at a time when replaying the spool
+	replayChunkSize = 256 << 10
+)
+
+// NetworkStats 网络输出的统计
+type NetworkStats struct {
+	// Sent 发送成功的日志条数
+	Sent uint64
+	// Dropped 队列已满、关闭后写入或发送失败且无法暂存而丢弃的日志条数
+	Dropped uint64
+	// Spooled 发送失败后写入暂存文件的日志条数
+	Spooled uint64
+	// Retries 发送失败后的重试次数
+	Retries uint64
+}
+
+var (
+	networkWritersMu sync.Mutex
+	// networkWriters 打开的网络输出, 同名输出可能有多个, 如同一配置创建的多个Logger
+	networkWriters = make(map[string][]*networkWriter)
+	// networkSpools 打开的网络输出使用的暂存文件
+	networkSpools = make(map[string]bool)
+)
+
+// GetNetworkStats returns the stats summed over the open network outputs named name.
+func GetNetworkStats(name string) (NetworkStats, bool) {
+	networkWritersMu.Lock()
+	writers := append([]*networkWriter(nil), networkWriters[name]...)
+	networkWritersMu.Unlock()
+	if len(writers) == 0 {
+		return NetworkStats{}, false
+	}
+	var stats NetworkStats
+	for _, w := range writers {
+		s := w.Stats()
+		stats.Sent += s.Sent
+		stats.Dropped += s.Dropped
+		stats.Spooled += s.Spooled
+		stats.Retries += s.Retries
+	}
+	return stats, true
+}
+
+// networkWriter ships the encoded entries to a TCP or HTTP endpoint in batches. Entries
+// are queued in memory, batches failed after retries are appended to the spool file
+// and replayed once the endpoint recovers.
+type networkWriter struct {
+	network string
+	address string
+	name    string
+
+	batchSize       int
+	batchInterval   time.Duration
+	policy          string
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	contentType     string
+
+	spoolPath    string
+	maxSpoolSize int64
+	// spoolSize 只在run中访问
+	spoolSize int64
+
+	queue   chan []byte
+	syncs   chan chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	conn   net.Conn
+	client *http.Client
+
+	sent, dropped, spooled, retries uint64
+}
+
+func newNetworkWriter(out *OutputConfig) (zapcore.WriteSyncer, error) {
+	w := &networkWriter{
+		network:         out.Network,
+		address:         out.Address,
+		name:            out.Name,
+		batchSize:       out.BatchSize,
+		batchInterval:   out.BatchInterval,
+		policy:          out.QueuePolicy,
+		maxRetries:      out.MaxRetries,
+		retryBackoff:    out.RetryBackoff,
+		maxRetryBackoff: out.MaxRetryBackoff,
+		maxSpoolSize:    out.MaxSpoolSize,
+		contentType:     "text/plain",
+		syncs:           make(chan chan struct{}),
+		closing:         make(chan struct{}),
+		done:            make(chan struct{}),
+		client:          &http.Client{Timeout: networkTimeout},
+	}
+	if w.network == "" {
+		w.network = "tcp"
+	}
+	if w.network != "tcp" && w.network != "http" {
+		return nil, fmt.Errorf("xlog: unsupported network output %q", w.network)
+	}
+	if w.address == "" {
+		return nil, fmt.Errorf("xlog: output %q requires address", out.Name)
+	}
+	if w.name == "" {
+		w.name = OutputNetwork
+	}
+	if w.batchSize <= 0 {
+		w.batchSize = defaultBatchSize
+	}
+	if w.batchInterval <= 0 {
+		w.batchInterval = defaultBatchInterval
+	}
+	switch w.policy {
+	case "":
+		w.policy = QueuePolicyDrop
+	case QueuePolicyDrop, QueuePolicyBlock:
+	default:
+		return nil, fmt.Errorf("xlog: unknown queue policy %q", w.policy)
+	}
+	if w.maxRetries < 0 {
+		w.maxRetries = 0
+	} else if w.maxRetries == 0 {
+		w.maxRetries = defaultMaxRetries
+	}
+	if w.retryBackoff <= 0 {
+		w.retryBackoff = defaultRetryBackoff
+	}
+	if w.maxRetryBackoff <= 0 {
+		w.maxRetryBackoff = defaultMaxRetryBackoff
+	}
+	if w.maxSpoolSize <= 0 {
+		w.maxSpoolSize = defaultMaxSpoolSize
+	}
+	if out.encoding() == EncodingJSON {
+		w.contentType = "application/x-ndjson"
+	}
+	queueSize := out.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	w.queue = make(chan []byte, queueSize)
+
+	if out.SpoolDir != "" {
+		if err := os.MkdirAll(out.SpoolDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	networkWritersMu.Lock()
+	if out.SpoolDir != "" {
+		// 每个输出独占一个暂存文件, 同名输出依次使用name.spool、name-2.spool...
+		w.spoolPath = filepath.Join(out.SpoolDir, w.name+".spool")
+		for i := 2; networkSpools[w.spoolPath]; i++ {
+			w.spoolPath = filepath.Join(out.SpoolDir, fmt.Sprintf("%s-%d.spool", w.name, i))
+		}
+		networkSpools[w.spoolPath] = true
+	}
+	networkWriters[w.name] = append(networkWriters[w.name], w)
+	networkWritersMu.Unlock()
+
+	// 补发上次运行遗留的日志
+	if w.spoolPath != "" {
+		if info, err := os.Stat(w.spoolPath); err == nil {
+			w.spoolSize = info.Size()
+		}
+	}
+
+	go w.run()
+	defers.Register(w.Close)
+	return w, nil
+}
+
+// Write queues a copy of p, it drops p or blocks according to the policy if the queue is full.
+func (w *networkWriter) Write(p []byte) (int, error) {
+	entry := append([]byte(nil), p...)
+	select {
+	case <-w.closing:
+		atomic.AddUint64(&w.dropped, 1)
+		return len(p), nil
+	default:
+	}
+
+	if w.policy == QueuePolicyBlock {
+		select {
+		case w.queue <- entry:
+		case <-w.closing:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+		return len(p), nil
+	}
+
+	select {
+	case w.queue <- entry:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Sync sends the queued entries and waits until they are sent, spooled or dropped.
+func (w *networkWriter) Sync() error {
+	req := make(chan struct{})
+	select {
+	case w.syncs <- req:
+		<-req
+	case <-w.done:
+	}
+	return nil
+}
+
+// Close sends the queued entries, stops shipping and releases the spool file.
+func (w *networkWriter) Close() error {
+	w.once.Do(func() {
+		close(w.closing)
+	})
+	<-w.done
+
+	networkWritersMu.Lock()
+	defer networkWritersMu.Unlock()
+	writers := networkWriters[w.name]
+	for i, item := range writers {
+		if item == w {
+			writers = append(writers[:i:i], writers[i+1:]...)
+			break
+		}
+	}
+	if len(writers) == 0 {
+		delete(networkWriters, w.name)
+	} else {
+		networkWriters[w.name] = writers
+	}
+	delete(networkSpools, w.spoolPath)
+	return nil
+}
+
+// Stats returns the stats of the writer.
+func (w *networkWriter) Stats() NetworkStats {
+	return NetworkStats{
+		Sent:    atomic.LoadUint64(&w.sent),
+		Dropped: atomic.LoadUint64(&w.dropped),
+		Spooled: atomic.LoadUint64(&w.spooled),
+		Retries: atomic.LoadUint64(&w.retries),
+	}
+}
+
+func (w *networkWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.batchInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case entry := <-w.queue:
+			if batch = append(batch, entry); len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = nil
+		case req := <-w.syncs:
+			w.flushAll(batch)
+			batch = nil
+			close(req)
+		case <-w.closing:
+			w.flushAll(batch)
+			if w.conn != nil {
+				w.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// flushAll sends batch and all the queued entries.
+func (w *networkWriter) flushAll(batch [][]byte) {
+	for {
+		select {
+		case entry := <-w.queue:
+			if batch = append(batch, entry); len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = nil
+			}
+		default:
+			w.flush(batch)
+			return
+		}
+	}
+}
+
+// flush sends batch with retries, the spool is replayed after a successful send.
+func (w *networkWriter) flush(batch [][]byte) {
+	if len(batch) == 0 {
+		w.replay()
+		return
+	}
+
+	data := bytes.Join(batch, nil)
+	if err := w.sendWithRetry(data); err != nil {
+		w.spool(data, len(batch))
+		return
+	}
+	atomic.AddUint64(&w.sent, uint64(len(batch)))
+	w.replay()
+}
+
+func (w *networkWriter) sendWithRetry(data []byte) error {
+	backoff := w.retryBackoff
+	err := w.send(data)
+	for i := 0; err != nil && i < w.maxRetries; i++ {
+		select {
+		case <-time.After(backoff):
+		case <-w.closing:
+			// 关闭时不再等待重试, 直接暂存
+			return err
+		}
+		if backoff *= 2; backoff > w.maxRetryBackoff {
+			backoff = w.maxRetryBackoff
+		}
+		atomic.AddUint64(&w.retries, 1)
+		err = w.send(data)
+	}
+	return err
+}
+
+func (w *networkWriter) send(data []byte) error {
+	if w.network == "http" {
+		resp, err := w.client.Post(w.address, w.contentType, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("xlog: unexpected status %s", resp.Status)
+		}
+		return nil
+	}
+
+	if w.conn == nil {
+		conn, err := net.DialTimeout("tcp", w.address, networkTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(networkTimeout))
+	if _, err := w.conn.Write(data); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// spool appends the n entries of data to the spool file, they are dropped if
+// spooling is disabled or the spool is full.
+func (w *networkWriter) spool(data []byte, n int) {
+	if w.spoolPath == "" || w.spoolSize+int64(len(data)) > w.maxSpoolSize {
+		atomic.AddUint64(&w.dropped, uint64(n))
+		return
+	}
+	f, err := os.OpenFile(w.spoolPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		atomic.AddUint64(&w.dropped, uint64(n))
+		return
+	}
+	written, err := f.Write(data)
+	f.Close()
+	w.spoolSize += int64(written)
+	if err != nil {
+		atomic.AddUint64(&w.dropped, uint64(n))
+		return
+	}
+	atomic.AddUint64(&w.spooled, uint64(n))
+}
+
+// replay sends the spooled entries in chunks, stops at the first failure and
+// keeps the entries not sent in the spool file.
+func (w *networkWriter) replay() {
+	if w.spoolSize == 0 {
+		return
+	}
+	f, err := os.Open(w.spoolPath)
+	if err != nil {
+		w.spoolSize = 0
+		return
+	}
+
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		var chunk []byte
+		var lines int
+		for len(chunk) < replayChunkSize {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				chunk = append(chunk, line...)
+				lines++
+			}
+			if err != nil {
+				break
+			}
+		}
+		if len(chunk) == 0 || w.send(chunk) != nil {
+			break
+		}
+		offset += int64(len(chunk))
+		atomic.AddUint64(&w.sent, uint64(lines))
+	}
+
+	if offset == 0 {
+		f.Close()
+		return
+	}
+	if offset >= w.spoolSize {
+		f.Close()
+		os.Remove(w.spoolPath)
+		w.spoolSize = 0
+		return
+	}
+	// 保留未发送的部分
+	var rest []byte
+	if _, err = f.Seek(offset, io.SeekStart); err == nil {
+		rest, err = ioutil.ReadAll(f)
+	}
+	f.Close()
+	if err != nil {
+		return
+	}
+	tmp := w.spoolPath + ".tmp"
+	if ioutil.WriteFile(tmp, rest, 0644) == nil && os.Rename(tmp, w.spoolPath) == nil {
+		w.spoolSize = int64(len(rest))
+	}
+}
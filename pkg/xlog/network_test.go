@@ -0,0 +1,286 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// httpCollector records the bodies of the requests, fails them while down is set.
+type httpCollector struct {
+	mu     sync.Mutex
+	bodies []string
+	types  []string
+	down   int32
+	// block 非空时阻塞请求直到关闭
+	block chan struct{}
+}
+
+func (c *httpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.block != nil {
+		<-c.block
+	}
+	if atomic.LoadInt32(&c.down) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	c.mu.Lock()
+	c.bodies = append(c.bodies, string(body))
+	c.types = append(c.types, r.Header.Get("Content-Type"))
+	c.mu.Unlock()
+}
+
+func (c *httpCollector) lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(strings.Join(c.bodies, ""), "\n"), "\n")
+}
+
+func TestNetwork_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	config := DefaultConfig()
+	config.AddCaller = false
+	config.Outputs = []OutputConfig{{
+		Name: "tcp-shipper", Type: OutputNetwork, Address: ln.Addr().String(),
+		Encoding: EncodingLogfmt, BatchSize: 2, BatchInterval: time.Hour,
+	}}
+	logger := config.Build()
+	logger.Info("a")
+	logger.Info("b")
+	logger.Info("c")
+	require.NoError(t, logger.Flush())
+
+	for _, msg := range []string{"a", "b", "c"} {
+		select {
+		case line := <-lines:
+			assert.Regexp(t, `^ts=\S+ lv=info msg=`+msg+`$`, line)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	stats, ok := GetNetworkStats("tcp-shipper")
+	require.True(t, ok)
+	assert.Equal(t, NetworkStats{Sent: 3}, stats)
+	require.NoError(t, logger.Close())
+	_, ok = GetNetworkStats("tcp-shipper")
+	assert.False(t, ok)
+}
+
+func TestNetwork_HTTP(t *testing.T) {
+	collector := &httpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	ws, err := newNetworkWriter(&OutputConfig{Type: OutputNetwork, Network: "http", Address: server.URL, BatchSize: 10})
+	require.NoError(t, err)
+	w := ws.(*networkWriter)
+	defer w.Close()
+
+	for _, line := range []string{"{\"a\":1}\n", "{\"b\":2}\n"} {
+		_, err := w.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Sync())
+	assert.Equal(t, []string{"{\"a\":1}\n{\"b\":2}\n"}, collector.bodies)
+	assert.Equal(t, []string{"application/x-ndjson"}, collector.types)
+
+	_, err = newNetworkWriter(&OutputConfig{Type: OutputNetwork, Network: "udp", Address: server.URL})
+	assert.EqualError(t, err, `xlog: unsupported network output "udp"`)
+	_, err = newNetworkWriter(&OutputConfig{Type: OutputNetwork, Address: server.URL, QueuePolicy: "wait"})
+	assert.EqualError(t, err, `xlog: unknown queue policy "wait"`)
+
+	// stats of the outputs sharing a name are summed
+	ws, err = newNetworkWriter(&OutputConfig{Type: OutputNetwork, Network: "http", Address: server.URL})
+	require.NoError(t, err)
+	_, err = ws.Write([]byte("{\"c\":3}\n"))
+	require.NoError(t, err)
+	require.NoError(t, ws.Sync())
+	stats, ok := GetNetworkStats(OutputNetwork)
+	require.True(t, ok)
+	assert.Equal(t, uint64(3), stats.Sent)
+	require.NoError(t, w.Close())
+	require.NoError(t, ws.(*networkWriter).Close())
+	_, ok = GetNetworkStats(OutputNetwork)
+	assert.False(t, ok)
+}
+
+func TestNetwork_QueuePolicy(t *testing.T) {
+	for _, policy := range []string{QueuePolicyDrop, QueuePolicyBlock} {
+		t.Run(policy, func(t *testing.T) {
+			collector := &httpCollector{block: make(chan struct{})}
+			server := httptest.NewServer(collector)
+			defer server.Close()
+
+			ws, err := newNetworkWriter(&OutputConfig{
+				Type: OutputNetwork, Network: "http", Address: server.URL,
+				BatchSize: 1, QueueSize: 1, QueuePolicy: policy,
+			})
+			require.NoError(t, err)
+			w := ws.(*networkWriter)
+
+			// the first entry blocks the sender, the second fills the queue
+			w.Write([]byte("1\n"))
+			require.Eventually(t, func() bool { return len(w.queue) == 0 }, time.Second, time.Millisecond)
+			w.Write([]byte("2\n"))
+
+			written := make(chan struct{})
+			go func() {
+				w.Write([]byte("3\n"))
+				close(written)
+			}()
+			if policy == QueuePolicyDrop {
+				<-written
+				assert.Equal(t, uint64(1), w.Stats().Dropped)
+			} else {
+				select {
+				case <-written:
+					t.Fatal("write should block while the queue is full")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+
+			close(collector.block)
+			<-written
+			require.NoError(t, w.Close())
+			if policy == QueuePolicyDrop {
+				assert.Equal(t, []string{"1", "2"}, collector.lines())
+				assert.Equal(t, NetworkStats{Sent: 2, Dropped: 1}, w.Stats())
+			} else {
+				assert.Equal(t, []string{"1", "2", "3"}, collector.lines())
+				assert.Equal(t, NetworkStats{Sent: 3}, w.Stats())
+			}
+
+			// entries written after closing are dropped
+			w.Write([]byte("4\n"))
+			assert.Equal(t, uint64(map[string]int{QueuePolicyDrop: 2, QueuePolicyBlock: 1}[policy]), w.Stats().Dropped)
+		})
+	}
+}
+
+func TestNetwork_Spool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	collector := &httpCollector{down: 1}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	ws, err := newNetworkWriter(&OutputConfig{
+		Name: "spool", Type: OutputNetwork, Network: "http", Address: server.URL,
+		MaxRetries: 2, RetryBackoff: time.Millisecond, SpoolDir: dir,
+	})
+	require.NoError(t, err)
+	w := ws.(*networkWriter)
+	defer w.Close()
+
+	w.Write([]byte("1\n"))
+	w.Write([]byte("2\n"))
+	require.NoError(t, w.Sync())
+	assert.Equal(t, NetworkStats{Spooled: 2, Retries: 2}, w.Stats())
+	content, err := ioutil.ReadFile(filepath.Join(dir, "spool.spool"))
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n", string(content))
+
+	// the spool is replayed once the remote recovers
+	atomic.StoreInt32(&collector.down, 0)
+	w.Write([]byte("3\n"))
+	require.NoError(t, w.Sync())
+	assert.Equal(t, []string{"3", "1", "2"}, collector.lines())
+	assert.Equal(t, NetworkStats{Sent: 3, Spooled: 2, Retries: 2}, w.Stats())
+	_, err = os.Stat(filepath.Join(dir, "spool.spool"))
+	assert.True(t, os.IsNotExist(err))
+
+	// without spool, failed batches are dropped
+	atomic.StoreInt32(&collector.down, 1)
+	ws, err = newNetworkWriter(&OutputConfig{Type: OutputNetwork, Network: "http", Address: server.URL, MaxRetries: -1})
+	require.NoError(t, err)
+	w = ws.(*networkWriter)
+	defer w.Close()
+	w.Write([]byte("4\n"))
+	require.NoError(t, w.Sync())
+	assert.Equal(t, NetworkStats{Dropped: 1}, w.Stats())
+}
+
+func TestNetwork_Loggers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(&httpCollector{})
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Outputs = []OutputConfig{
+		{Type: OutputNetwork, Network: "http", Address: server.URL, SpoolDir: dir},
+		{Type: "unknown"},
+	}
+	// outputs created before a failing one are closed
+	assert.Panics(t, func() { config.Build() })
+	_, ok := GetNetworkStats(OutputNetwork)
+	assert.False(t, ok)
+
+	// loggers built from the same config use their own spool files
+	config.Outputs = config.Outputs[:1]
+	a, b := config.Build(), config.Build()
+	spools := func() []string {
+		var paths []string
+		for _, w := range networkWriters[OutputNetwork] {
+			paths = append(paths, filepath.Base(w.spoolPath))
+		}
+		return paths
+	}
+	assert.Equal(t, []string{"network.spool", "network-2.spool"}, spools())
+
+	require.NoError(t, a.Close())
+	assert.Equal(t, []string{"network-2.spool"}, spools())
+	c := config.Build()
+	assert.Equal(t, []string{"network-2.spool", "network.spool"}, spools())
+	require.NoError(t, b.Close())
+	require.NoError(t, c.Close())
+	_, ok = GetNetworkStats(OutputNetwork)
+	assert.False(t, ok)
+}
@@ -0,0 +1,293 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mesment/sparrow/pkg/defers"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// 内置的日志输出类型
+const (
+	OutputStdout   = "stdout"
+	OutputStderr   = "stderr"
+	OutputFile     = "file"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+	OutputNetwork  = "network"
+)
+
+// OutputConfig 日志输出配置, 多个输出同时写入, 各自拥有独立的级别、编码格式和异步设置
+type OutputConfig struct {
+	// Name 输出名称, 如error, network输出默认为network
+	Name string
+	// Type 输出类型, 内置stdout、stderr、file、syslog、journald、network, 可通过RegisterSink扩展
+	Type string
+	// Level 输出级别, 为空时使用Config.Level, 并随SetLevel和AutoLevel动态调整
+	Level string
+	// Encoding 编码格式, 如json、console、logfmt, 为空时file和network输出使用json, 其他输出使用console
+	Encoding string
+	// Async 是否缓冲异步写入, syslog和journald等EntryWriter输出不支持
+	Async bool
+
+	// Dir 日志文件输出目录, 为空时使用Config.Dir
+	Dir string
+	// Filename 日志文件名称
+	Filename string
+	// MaxSize 日志文件最大长度(单位 M), 为0时使用Config.MaxSize
+	MaxSize int
+	// MaxAge 保存日志文件最长天数, 为0时使用Config.MaxAge
+	MaxAge int
+	// MaxBackup 保存日志文件最大个数, 为0时使用Config.MaxBackup
+	MaxBackup int
+	// Interval 日志文件切割间隔, 为0时使用Config.Interval
+	Interval time.Duration
+
+	// Network 网络类型, syslog支持unix、udp、tcp, 默认为unix; network支持tcp、http, 默认为tcp
+	Network string
+	// Address 输出地址, syslog和journald默认为本机的unix socket, network输出为host:port或http地址
+	Address string
+	// Facility syslog facility, 如user、daemon、local0, 默认为user
+	Facility string
+	// Tag syslog的APP-NAME及journald的SYSLOG_IDENTIFIER, 默认为进程名
+	Tag string
+
+	// BatchSize network输出每批发送的最大日志条数, 默认100
+	BatchSize int
+	// BatchInterval network输出未满一批时的最长等待时间, 默认1s
+	BatchInterval time.Duration
+	// QueueSize network输出内存队列可缓存的日志条数, 默认10000
+	QueueSize int
+	// QueuePolicy network输出队列满时的处理策略, drop丢弃新日志, block阻塞写入, 默认drop
+	QueuePolicy string
+	// MaxRetries network输出发送失败时的最大重试次数, 默认3, 小于0时不重试
+	MaxRetries int
+	// RetryBackoff 首次重试的等待时间, 之后成倍增长至MaxRetryBackoff, 默认100ms和10s
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// SpoolDir 重试后仍发送失败的日志暂存目录, 远端恢复后补发, 为空时丢弃
+	SpoolDir string
+	// MaxSpoolSize 暂存文件的最大字节数, 默认100M
+	MaxSpoolSize int64
+}
+
+// Path returns the path of the log file.
+func (out *OutputConfig) Path() string {
+	return fmt.Sprintf("%s/%s", out.Dir, out.Filename)
+}
+
+func (out *OutputConfig) encoding() string {
+	if out.Encoding != "" {
+		return out.Encoding
+	}
+	if out.Type == OutputFile || out.Type == OutputNetwork {
+		return EncodingJSON
+	}
+	return EncodingConsole
+}
+
+// SinkFactory creates the writer of an output.
+type SinkFactory func(out *OutputConfig) (zapcore.WriteSyncer, error)
+
+// EntryWriter is implemented by writers requiring the entry of each message, e.g. the level,
+// messages are written by WriteEntry instead of Write and never buffered, Async is rejected.
+type EntryWriter interface {
+	zapcore.WriteSyncer
+	WriteEntry(ent zapcore.Entry, p []byte) error
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]SinkFactory{
+		OutputStdout: func(*OutputConfig) (zapcore.WriteSyncer, error) {
+			return zapcore.Lock(os.Stdout), nil
+		},
+		OutputStderr: func(*OutputConfig) (zapcore.WriteSyncer, error) {
+			return zapcore.Lock(os.Stderr), nil
+		},
+		OutputFile: func(out *OutputConfig) (zapcore.WriteSyncer, error) {
+			if out.Filename == "" {
+				return nil, fmt.Errorf("xlog: output %q requires filename", out.Name)
+			}
+			return zapcore.AddSync(newRotate(out)), nil
+		},
+		OutputSyslog:   newSyslogWriter,
+		OutputJournald: newJournaldWriter,
+		OutputNetwork:  newNetworkWriter,
+	}
+)
+
+// RegisterSink registers the sink factory of output type typ, registering an existing type replaces it.
+func RegisterSink(typ string, factory SinkFactory) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks[typ] = factory
+}
+
+// outputs returns the outputs of config, EnableConsole and EnableFile are
+// converted to a stdout and a file output in front of Outputs.
+func (config *Config) outputs() []OutputConfig {
+	var outputs []OutputConfig
+	if config.EnableConsole {
+		outputs = append(outputs, OutputConfig{
+			Name: "console",
+			Type: OutputStdout,
+			// 与之前的版本一致, 无法识别的ConsoleLevel按info处理
+			Level:    getZapLevel(config.ConsoleLevel).String(),
+			Encoding: config.consoleEncoding(),
+			Async:    config.Async,
+		})
+	}
+	if config.EnableFile {
+		outputs = append(outputs, OutputConfig{
+			Name:     "file",
+			Type:     OutputFile,
+			Encoding: config.fileEncoding(),
+			Async:    config.Async,
+			Filename: config.Name,
+		})
+	}
+
+	outputs = append(outputs, config.Outputs...)
+	for i := range outputs {
+		out := &outputs[i]
+		if out.Type != OutputFile {
+			continue
+		}
+		if out.Dir == "" {
+			out.Dir = config.Dir
+		}
+		if out.MaxSize == 0 {
+			out.MaxSize = config.MaxSize
+		}
+		if out.MaxAge == 0 {
+			out.MaxAge = config.MaxAge
+		}
+		if out.MaxBackup == 0 {
+			out.MaxBackup = config.MaxBackup
+		}
+		if out.Interval == 0 {
+			out.Interval = config.Interval
+		}
+	}
+	return outputs
+}
+
+// newCore creates the core writing to out, outputs without level share lv.
+// close flushes the buffer and closes the writer if it implements io.Closer.
+func newCore(config *Config, out OutputConfig, lv zap.AtomicLevel) (core zapcore.Core, close CloseFunc, err error) {
+	sinksMu.RLock()
+	factory, ok := sinks[out.Type]
+	sinksMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("xlog: unknown output type %q", out.Type)
+	}
+
+	if out.Level != "" {
+		lv = zap.NewAtomicLevel()
+		if err := lv.UnmarshalText([]byte(out.Level)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	encoderConfig := *config.EncoderConfig
+	if config.Debug && !(out.encoding() == EncodingConsole && (out.Type == OutputStdout || out.Type == OutputStderr)) {
+		// 日志级别颜色只在控制台显示, 避免颜色控制符影响日志采集
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+	}
+	encoder, err := newEncoder(out.encoding(), encoderConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writer, err := factory(&out)
+	if err != nil {
+		return nil, nil, err
+	}
+	close = func() error { return nil }
+	if closer, ok := writer.(io.Closer); ok {
+		close = closer.Close
+	}
+	if ew, ok := writer.(EntryWriter); ok {
+		if out.Async {
+			close()
+			return nil, nil, fmt.Errorf("xlog: output %q of type %q does not support async", out.Name, out.Type)
+		}
+		return &entryCore{LevelEnabler: lv, enc: encoder, out: ew}, close, nil
+	}
+	if out.Async {
+		var flush CloseFunc
+		writer, flush = Buffer(writer, defaultBufferSize, defaultFlushInterval)
+		defers.Register(flush)
+		closeWriter := close
+		close = func() error {
+			err := flush()
+			if cerr := closeWriter(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+	}
+	return zapcore.NewCore(encoder, writer, lv), close, nil
+}
+
+// entryCore writes the encoded entries to an EntryWriter.
+type entryCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out EntryWriter
+}
+
+func (c *entryCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &entryCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), out: c.out}
+	for _, field := range fields {
+		field.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *entryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *entryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	err = c.out.WriteEntry(ent, buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		c.Sync()
+	}
+	return nil
+}
+
+func (c *entryCore) Sync() error {
+	return c.out.Sync()
+}
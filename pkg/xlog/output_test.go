@@ -0,0 +1,104 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogger_Outputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var memory bytes.Buffer
+	RegisterSink("memory", func(*OutputConfig) (zapcore.WriteSyncer, error) {
+		return zapcore.AddSync(&memory), nil
+	})
+
+	config := DefaultConfig()
+	config.Dir = dir
+	config.AddCaller = false
+	config.Async = false
+	config.Outputs = []OutputConfig{
+		{Name: "app", Type: OutputFile, Filename: "app.log"},
+		{Name: "error", Type: OutputFile, Filename: "error.log", Level: "error", Encoding: EncodingLogfmt},
+		{Name: "memory", Type: "memory", Level: "debug", Encoding: EncodingLogfmt, Async: true},
+	}
+	logger := config.Build()
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Error("error")
+	require.NoError(t, logger.Flush())
+
+	app, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^\{"lv":"info",.*"msg":"info"\}\n\{"lv":"error",.*"msg":"error"\}\n$`, string(app))
+
+	errorLog, err := ioutil.ReadFile(filepath.Join(dir, "error.log"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^ts=\S+ lv=error msg=error\n$`, string(errorLog))
+
+	assert.Regexp(t, `^ts=\S+ lv=debug msg=debug\nts=\S+ lv=info msg=info\nts=\S+ lv=error msg=error\n$`, memory.String())
+
+	// outputs without level follow the level of the logger
+	logger.SetLevel(ErrorLevel)
+	logger.Info("ignored")
+	require.NoError(t, logger.Flush())
+	app, err = ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(app), "ignored")
+	assert.Contains(t, memory.String(), "ignored")
+}
+
+func TestConfig_Outputs(t *testing.T) {
+	config := DefaultConfig()
+	config.EnableConsole = true
+	config.EnableFile = true
+	config.ConsoleJSONFormat = true
+	config.Outputs = []OutputConfig{{Type: OutputFile, Filename: "error.log", MaxAge: 7}, {Type: OutputStderr}}
+
+	outputs := config.outputs()
+	require.Len(t, outputs, 4)
+	assert.Equal(t, OutputConfig{Name: "console", Type: OutputStdout, Level: "info", Encoding: EncodingJSON, Async: true}, outputs[0])
+	assert.Equal(t, "./default.log", outputs[1].Path())
+	assert.Equal(t, EncodingJSON, outputs[1].encoding())
+	assert.Equal(t, 7, outputs[2].MaxAge)
+	assert.Equal(t, config.MaxSize, outputs[2].MaxSize)
+	assert.Equal(t, EncodingConsole, outputs[3].encoding())
+
+	// unknown console levels fall back to info as before
+	config.ConsoleLevel = "warning"
+	assert.Equal(t, "info", config.outputs()[0].Level)
+	config.ConsoleLevel = "error"
+	assert.Equal(t, "error", config.outputs()[0].Level)
+	assert.NotPanics(t, func() {
+		config := DefaultConfig()
+		config.EnableConsole, config.ConsoleLevel = true, "warning"
+		require.NoError(t, config.Build().Close())
+	})
+
+	config = DefaultConfig()
+	config.Outputs = []OutputConfig{{Name: "bad", Type: "unknown"}}
+	assert.PanicsWithError(t, `xlog: unknown output type "unknown"`, func() { config.Build() })
+}
@@ -20,13 +20,13 @@ import (
 	"github.com/mesment/sparrow/pkg/xlog/rotate"
 )
 
-func newRotate(config *Config) io.Writer {
+func newRotate(out *OutputConfig) io.Writer {
 	rotateLog := rotate.NewLogger()
-	rotateLog.Filename = config.Filename()
-	rotateLog.MaxSize = config.MaxSize // MB
-	rotateLog.MaxAge = config.MaxAge   // days
-	rotateLog.MaxBackups = config.MaxBackup
-	rotateLog.Interval = config.Interval
+	rotateLog.Filename = out.Path()
+	rotateLog.MaxSize = out.MaxSize // MB
+	rotateLog.MaxAge = out.MaxAge   // days
+	rotateLog.MaxBackups = out.MaxBackup
+	rotateLog.Interval = out.Interval
 	rotateLog.LocalTime = true
 	rotateLog.Compress = false
 	return rotateLog
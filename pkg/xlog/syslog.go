@@ -0,0 +1,235 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// rfc5424Time is the TIMESTAMP of RFC 5424, at most 6 digits of fractional seconds.
+	rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+	// syslogTimeout bounds dialing and sending a message, a stalled server never blocks logging for long
+	syslogTimeout = 5 * time.Second
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSockets are the unix sockets of the local syslog daemon.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// severity maps the level to the syslog severity, it is also the journald PRIORITY.
+func severity(lv zapcore.Level) int {
+	switch lv {
+	case zapcore.DebugLevel:
+		return 7 // debug
+	case zapcore.InfoLevel:
+		return 6 // info
+	case zapcore.WarnLevel:
+		return 4 // warning
+	case zapcore.ErrorLevel:
+		return 3 // err
+	case zapcore.DPanicLevel:
+		return 2 // crit
+	case zapcore.PanicLevel:
+		return 1 // alert
+	case zapcore.FatalLevel:
+		return 0 // emerg
+	default:
+		return 6
+	}
+}
+
+// syslogTag returns tag or the process name.
+func syslogTag(tag string) string {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	return tag
+}
+
+// syslogWriter sends RFC 5424 messages to a syslog server over unix socket, UDP or TCP,
+// messages over TCP are framed by octet counting (RFC 6587).
+type syslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	facility int
+	hostname string
+	tag      string
+	pid      int
+	conn     net.Conn
+	// connNetwork 实际连接的网络类型, unix socket可能为unixgram或unix
+	connNetwork string
+}
+
+func newSyslogWriter(out *OutputConfig) (zapcore.WriteSyncer, error) {
+	facility := syslogFacilities["user"]
+	if out.Facility != "" {
+		var ok bool
+		if facility, ok = syslogFacilities[out.Facility]; !ok {
+			return nil, fmt.Errorf("xlog: unknown syslog facility %q", out.Facility)
+		}
+	}
+	hostname, _ := os.Hostname()
+
+	w := &syslogWriter{
+		network:  out.Network,
+		address:  out.Address,
+		facility: facility,
+		hostname: syslogHeader(hostname, 255),
+		tag:      syslogHeader(syslogTag(out.Tag), 48),
+		pid:      os.Getpid(),
+	}
+	if w.network == "" {
+		w.network = "unix"
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect must be called with mu held.
+func (w *syslogWriter) connect() error {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	switch w.network {
+	case "unix":
+		addresses := syslogSockets
+		if w.address != "" {
+			addresses = []string{w.address}
+		}
+		for _, address := range addresses {
+			for _, network := range []string{"unixgram", "unix"} {
+				if conn, err := net.Dial(network, address); err == nil {
+					w.conn, w.connNetwork = conn, network
+					return nil
+				}
+			}
+		}
+		return errors.New("xlog: unix syslog delivery error")
+	case "udp", "tcp":
+		conn, err := net.DialTimeout(w.network, w.address, syslogTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn, w.connNetwork = conn, w.network
+		return nil
+	default:
+		return fmt.Errorf("xlog: unsupported syslog network %q", w.network)
+	}
+}
+
+// Write sends p with info level.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now()}, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry sends the encoded entry p, reconnects once if sending fails.
+func (w *syslogWriter) WriteEntry(ent zapcore.Entry, p []byte) error {
+	msg := w.format(ent, p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return nil
+		}
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	return w.send(msg)
+}
+
+// send must be called with mu held.
+func (w *syslogWriter) send(msg []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	_, err := w.conn.Write(w.frame(msg))
+	return err
+}
+
+// frame delimits msg on stream connections, must be called with mu held.
+func (w *syslogWriter) frame(msg []byte) []byte {
+	switch w.connNetwork {
+	case "tcp":
+		return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	case "unix":
+		// 流式unix socket以换行分隔消息
+		return append(msg, '\n')
+	default:
+		return msg
+	}
+}
+
+func (w *syslogWriter) format(ent zapcore.Entry, p []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - - ",
+		w.facility*8+severity(ent.Level), ent.Time.Format(rfc5424Time), w.hostname, w.tag, w.pid)
+	buf.Write(bytes.TrimRight(p, "\r\n"))
+	return buf.Bytes()
+}
+
+func (w *syslogWriter) Sync() error {
+	return nil
+}
+
+// Close closes the connection, a later write reconnects.
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogHeader returns s as a header field of RFC 5424, printable ASCII without spaces, "-" if empty.
+func syslogHeader(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Douyu
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xlog
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func syslogLogger(out OutputConfig) *Logger {
+	config := DefaultConfig()
+	config.AddCaller = false
+	config.Outputs = []OutputConfig{out}
+	return config.Build()
+}
+
+func TestSyslog_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger := syslogLogger(OutputConfig{
+		Type: OutputSyslog, Network: "udp", Address: conn.LocalAddr().String(),
+		Facility: "local0", Tag: "my app", Encoding: EncodingLogfmt,
+	})
+	logger.Error("boom", String("a", "b"))
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	// local0(16)*8 + err(3)
+	assert.Regexp(t, `^<131>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ myapp `+strconv.Itoa(os.Getpid())+
+		` - - ts=\S+ lv=error msg=boom a=b$`, string(buf[:n]))
+}
+
+func TestSyslog_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	logger := syslogLogger(OutputConfig{Type: OutputSyslog, Network: "tcp", Address: ln.Addr().String()})
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger.Info("hello\nworld")
+	logger.Warn("bye")
+
+	// octet counting framing
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{`(?s)^<14>1 .*\thello\nworld$`, `^<12>1 .*\tbye$`} {
+		size, err := reader.ReadString(' ')
+		require.NoError(t, err)
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		require.NoError(t, err)
+		msg := make([]byte, n)
+		_, err = io.ReadFull(reader, msg)
+		require.NoError(t, err)
+		assert.Regexp(t, expected, string(msg))
+	}
+}
+
+func TestSyslog_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	address := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger := syslogLogger(OutputConfig{Type: OutputSyslog, Address: address, Facility: "daemon"})
+	logger.Debug("ignored")
+	logger.Info("hello")
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Regexp(t, `^<30>1 .*\thello$`, string(buf[:n]))
+}
+
+func TestSyslog_Config(t *testing.T) {
+	assert.PanicsWithError(t, `xlog: unknown syslog facility "bad"`, func() {
+		syslogLogger(OutputConfig{Type: OutputSyslog, Network: "udp", Address: "127.0.0.1:514", Facility: "bad"})
+	})
+	assert.PanicsWithError(t, `xlog: unsupported syslog network "ip"`, func() {
+		syslogLogger(OutputConfig{Type: OutputSyslog, Network: "ip"})
+	})
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.PanicsWithError(t, `xlog: output "remote" of type "syslog" does not support async`, func() {
+		syslogLogger(OutputConfig{Name: "remote", Type: OutputSyslog, Network: "udp", Address: conn.LocalAddr().String(), Async: true})
+	})
+
+	assert.Equal(t, 7, severity(zapcore.DebugLevel))
+	assert.Equal(t, 4, severity(zapcore.WarnLevel))
+	assert.Equal(t, 0, severity(zapcore.FatalLevel))
+	assert.Equal(t, "-", syslogHeader(" ", 48))
+	assert.Equal(t, "ab", syslogHeader("a b c", 2))
+}